@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/voidwyrm-2/matrix/api/internal"
+)
+
+// the cache in the user's cache folder, like ~/.cache/matrix, empty if there isn't one
+func DefaultDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "matrix")
+}
+
+// where responses and downloaded files are kept, nothing is cached if it's empty
+func Dir() string {
+	return internal.CacheDir
+}
+
+func SetDir(dir string) {
+	internal.CacheDir = dir
+}
+
+// whether nothing is requested and everything comes from the cache,
+// which is turned on by itself the first time a request fails because there's no network
+func Offline() bool {
+	return internal.Offline()
+}
+
+func SetOffline(offline bool) {
+	internal.SetOffline(offline)
+}
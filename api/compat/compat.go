@@ -0,0 +1,116 @@
+package compat
+
+import (
+	_ "embed"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/voidwyrm-2/matrix/api/errs"
+)
+
+//go:embed rules.txt
+var rawRules string
+
+type accept struct {
+	loader       string
+	gameVersions []string
+}
+
+type Table struct {
+	accepts map[string][]accept
+	skips   map[string][]string
+}
+
+func Default() Table {
+	t, err := Parse(strings.Split(rawRules, "\n"))
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return t
+}
+
+func Parse(lines []string) (Table, error) {
+	t := Table{accepts: map[string][]accept{}, skips: map[string][]string{}}
+
+	for i, l := range lines {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "!") {
+			continue
+		}
+
+		if err := t.add(strings.Fields(l)); err != nil {
+			return Table{}, errs.Errorf(errs.ErrParse, "compatibility rule %d ('%s'): %s", i+1, l, err.Error())
+		}
+	}
+
+	return t, nil
+}
+
+func (t Table) add(fields []string) error {
+	lower := func(s []string) []string {
+		for i := range s {
+			s[i] = strings.ToLower(s[i])
+		}
+
+		return s
+	}
+
+	switch strings.ToLower(fields[0]) {
+	case "accept":
+		if len(fields) < 3 {
+			return fmt.Errorf("expected 'accept <pack loader> <mod loader> [game versions...]'")
+		}
+
+		lower(fields[1:3])
+		t.accepts[fields[1]] = append(t.accepts[fields[1]], accept{loader: fields[2], gameVersions: fields[3:]})
+	case "skip":
+		if len(fields) < 4 || strings.ToLower(fields[2]) != "unless" {
+			return fmt.Errorf("expected 'skip <project id> unless <loaders...>'")
+		}
+
+		// project ids are case sensitive, so only the loaders are lowercased
+		t.skips[fields[1]] = append(t.skips[fields[1]], lower(fields[3:])...)
+	default:
+		return fmt.Errorf("unknown rule '%s'", fields[0])
+	}
+
+	return nil
+}
+
+// returns a table with the rules of both, for layering a pack's own rules over the defaults
+func (t Table) Merge(other Table) Table {
+	merged := Table{accepts: map[string][]accept{}, skips: map[string][]string{}}
+
+	for _, src := range []Table{t, other} {
+		for k, v := range src.accepts {
+			merged.accepts[k] = append(merged.accepts[k], v...)
+		}
+
+		for k, v := range src.skips {
+			merged.skips[k] = append(merged.skips[k], v...)
+		}
+	}
+
+	return merged
+}
+
+// returns the loaders whose mods can run on the given loader and game version, most preferred first
+func (t Table) Loaders(loader, gameVersion string) []string {
+	loaders := []string{loader}
+
+	for _, a := range t.accepts[loader] {
+		if (len(a.gameVersions) == 0 || slices.Contains(a.gameVersions, gameVersion)) && !slices.Contains(loaders, a.loader) {
+			loaders = append(loaders, a.loader)
+		}
+	}
+
+	return loaders
+}
+
+// reports if a dependency on the project should be left out when running on the given loader
+func (t Table) Skip(projectId, loader string) bool {
+	loaders, ok := t.skips[projectId]
+	return ok && !slices.Contains(loaders, loader)
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/voidwyrm-2/matrix/api/errs"
+	"github.com/voidwyrm-2/matrix/api/internal"
+)
+
+// the config file of a pack, relative to its folder
+var ProjectPath = filepath.Join(".matrix", "config.toml")
+
+// a config file, with its tables flattened into dotted keys
+type File struct {
+	Path   string
+	Values map[string]string
+}
+
+// the config file for the user, in $XDG_CONFIG_HOME/matrix or wherever the OS keeps them
+func UserPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "matrix", "config.toml"), nil
+}
+
+func flatten(prefix string, table map[string]any, values map[string]string) {
+	for k, v := range table {
+		if sub, ok := v.(map[string]any); ok {
+			flatten(prefix+k+".", sub, values)
+		} else {
+			values[prefix+k] = fmt.Sprint(v)
+		}
+	}
+}
+
+// reads a config file, which is empty if it doesn't exist
+func Read(path string) (File, error) {
+	f := File{Path: path, Values: map[string]string{}}
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	} else if err != nil {
+		return f, err
+	}
+
+	table := map[string]any{}
+	if _, err := toml.Decode(string(content), &table); err != nil {
+		return f, errs.Toml(path, err)
+	}
+
+	flatten("", table, f.Values)
+
+	return f, nil
+}
+
+func (f File) Write() error {
+	table := map[string]any{}
+
+	keys := []string{}
+	for k := range f.Values {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		parts := strings.Split(k, ".")
+		t := table
+
+		for _, part := range parts[:len(parts)-1] {
+			sub, ok := t[part].(map[string]any)
+			if !ok {
+				sub = map[string]any{}
+				t[part] = sub
+			}
+
+			t = sub
+		}
+
+		t[parts[len(parts)-1]] = f.Values[k]
+	}
+
+	buf := bytes.Buffer{}
+	if err := toml.NewEncoder(&buf).Encode(table); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.Path), os.ModeDir|os.ModePerm); err != nil {
+		return err
+	}
+
+	return internal.WriteFile(f.Path, buf.Bytes())
+}
+
+// the environment variable a key can be set with, e.g. MATRIX_SYNC_SIDE for sync.side
+func EnvName(key string) string {
+	return "MATRIX_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(key))
+}
+
+// a layer of configuration, later layers winning over earlier ones
+type Layer struct {
+	Name   string
+	Values map[string]string
+}
+
+// reads the user's config, the pack's config and the environment, in the order they apply in
+func Load(keys []string) ([]Layer, error) {
+	layers := []Layer{}
+
+	user, err := UserPath()
+	if err == nil {
+		f, err := Read(user)
+		if err != nil {
+			return nil, err
+		}
+
+		layers = append(layers, Layer{Name: user, Values: f.Values})
+	}
+
+	project, err := Read(ProjectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	layers = append(layers, Layer{Name: ProjectPath, Values: project.Values})
+
+	env := Layer{Name: "environment", Values: map[string]string{}}
+	for _, k := range keys {
+		if v, ok := os.LookupEnv(EnvName(k)); ok {
+			env.Values[k] = v
+		}
+	}
+
+	return append(layers, env), nil
+}
+
+// finds the value of a key and the layer it came from
+func Lookup(layers []Layer, key string) (string, string, bool) {
+	for i := len(layers) - 1; i >= 0; i-- {
+		if v, ok := layers[i].Values[key]; ok {
+			return v, layers[i].Name, true
+		}
+	}
+
+	return "", "", false
+}
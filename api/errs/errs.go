@@ -0,0 +1,161 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// what went wrong, for errors.Is
+var (
+	// a mod, version, profile or file that doesn't exist
+	ErrNotFound = errors.New("not found")
+	// mods or versions that can't be used together, or a file from a newer version of matrix
+	ErrIncompatible = errors.New("incompatible")
+	// a request that couldn't be made or didn't succeed
+	ErrNetwork = errors.New("network error")
+	// a download that doesn't match the hash it should have
+	ErrHashMismatch = errors.New("hash mismatch")
+	// a file that couldn't be parsed; the Matrixfile's errors are *matrixfile.Error and the toml files' are *ParseError
+	ErrParse = errors.New("parse error")
+	// something that was needed while offline but isn't cached, which is a *MissingError or an *OfflineError
+	ErrOffline = errors.New("not available offline")
+)
+
+// an error with its own message that errors.Is matches with its kind
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// formats an error like fmt.Errorf, which errors.Is matches with kind
+func Errorf(kind error, format string, a ...any) error {
+	return &kindError{kind: kind, err: fmt.Errorf(format, a...)}
+}
+
+// a request that failed, either because it couldn't be made (Err) or because of its status
+type NetworkError struct {
+	Url        string
+	StatusCode int
+	Status     string
+	Err        error
+}
+
+func (e *NetworkError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+
+	return fmt.Sprintf("status code %d, '%s' from '%s'", e.StatusCode, e.Status, e.Url)
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// also matches ErrNotFound for a 404
+func (e *NetworkError) Is(target error) bool {
+	return target == ErrNetwork || (target == ErrNotFound && e.StatusCode == 404)
+}
+
+// something that was needed while offline but isn't cached, like "project 'sodium'"
+type MissingError struct {
+	What string
+}
+
+func (e *MissingError) Error() string {
+	return e.What + " isn't cached, so it can't be used offline"
+}
+
+func (e *MissingError) Is(target error) bool {
+	return target == ErrOffline
+}
+
+// everything that was needed while offline but isn't cached
+type OfflineError struct {
+	Missing []string
+}
+
+func (e *OfflineError) Error() string {
+	return "these aren't cached, so they can't be used offline:\n  " + strings.Join(e.Missing, "\n  ")
+}
+
+func (e *OfflineError) Is(target error) bool {
+	return target == ErrOffline
+}
+
+// gathers every *MissingError in err, which can be joined from many errors, into one *OfflineError;
+// if they're all about the same thing that one is returned, and err is returned as it is if there aren't any
+func Offline(err error) error {
+	missing := []string{}
+	var first *MissingError
+
+	var walk func(err error)
+	walk = func(err error) {
+		var me *MissingError
+
+		switch e := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, err := range e.Unwrap() {
+				walk(err)
+			}
+		default:
+			if errors.As(err, &me) && !slices.Contains(missing, me.What) {
+				missing = append(missing, me.What)
+				if first == nil {
+					first = me
+				}
+			}
+		}
+	}
+
+	walk(err)
+
+	switch len(missing) {
+	case 0:
+		return err
+	case 1:
+		return first
+	}
+
+	return &OfflineError{Missing: missing}
+}
+
+type ParseError struct {
+	File      string
+	Line, Col int
+	Msg       string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Col, e.Msg)
+}
+
+func (e *ParseError) Is(target error) bool {
+	return target == ErrParse
+}
+
+// turns an error from decoding the toml file into a *ParseError
+func Toml(name string, err error) error {
+	var pe toml.ParseError
+	if errors.As(err, &pe) {
+		return &ParseError{File: name, Line: pe.Position.Line, Col: pe.Position.Col, Msg: pe.Message}
+	}
+
+	return err
+}
@@ -0,0 +1,41 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestIs(t *testing.T) {
+	_, tomlErr := toml.Decode("a = = 1", &map[string]any{})
+
+	cases := []struct {
+		err   error
+		kinds []error
+		msg   string
+	}{
+		{Errorf(ErrNotFound, "mod '%s' is not in the modpack", "x"), []error{ErrNotFound}, "mod 'x' is not in the modpack"},
+		{fmt.Errorf("syncing: %w", Errorf(ErrIncompatible, "nope")), []error{ErrIncompatible}, "syncing: nope"},
+		{&NetworkError{Url: "u", StatusCode: 404, Status: "404 Not Found"}, []error{ErrNetwork, ErrNotFound}, "status code 404, '404 Not Found' from 'u'"},
+		{&NetworkError{Url: "u", StatusCode: 403, Status: "403 Forbidden"}, []error{ErrNetwork}, "status code 403, '403 Forbidden' from 'u'"},
+		{Toml("matrix.toml", tomlErr), []error{ErrParse}, "matrix.toml:1:5: expected value but found '=' instead"},
+		{&MissingError{What: "project 'a'"}, []error{ErrOffline}, "project 'a' isn't cached, so it can't be used offline"},
+		{Offline(errors.Join(&MissingError{What: "project 'a'"}, fmt.Errorf("a: %w", &MissingError{What: "project 'a'"}))), []error{ErrOffline}, "project 'a' isn't cached, so it can't be used offline"},
+		{Offline(errors.Join(&MissingError{What: "project 'a'"}, fmt.Errorf("b: %w", &MissingError{What: "file 'b.jar'"}), &MissingError{What: "project 'a'"})), []error{ErrOffline}, "these aren't cached, so they can't be used offline:\n  project 'a'\n  file 'b.jar'"},
+	}
+
+	for _, c := range cases {
+		if c.err.Error() != c.msg {
+			t.Fatalf("expected '%s', but got '%s'", c.msg, c.err.Error())
+		}
+
+		for _, kind := range []error{ErrNotFound, ErrIncompatible, ErrNetwork, ErrHashMismatch, ErrParse, ErrOffline} {
+			if expect := slices.Contains(c.kinds, kind); errors.Is(c.err, kind) != expect {
+				t.Fatalf("'%s': expected errors.Is(%v) to be %t", c.msg, kind, expect)
+			}
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/voidwyrm-2/matrix/api/errs"
+	"github.com/voidwyrm-2/matrix/api/logging"
+)
+
+// where responses and downloaded files are kept between runs, nothing is cached if it's empty
+var CacheDir string
+
+var offline atomic.Bool
+
+// whether nothing is requested, so everything has to come from the cache;
+// it's turned on by itself the first time a request fails because there's no network
+func Offline() bool {
+	return offline.Load()
+}
+
+func SetOffline(b bool) {
+	offline.Store(b)
+}
+
+// whether a request failed because there's no network, rather than because of the server
+func noNetwork(ctx context.Context, err error) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+
+	return ctx.Err() == nil && (errors.As(err, &opErr) || errors.As(err, &dnsErr))
+}
+
+// turns offline mode on after a request found there's no network
+func goOffline(url string, err error) {
+	if !offline.Swap(true) {
+		slog.Warn("couldn't reach "+url+", so everything will come from the cache", "url", url, "err", err.Error())
+	}
+}
+
+// a cached response and what's needed to check if it's still current
+type cacheEntry struct {
+	Url          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Body         []byte `json:"body"`
+}
+
+func entryPath(url string) string {
+	return filepath.Join(CacheDir, "http", Sha1([]byte(url))+".json")
+}
+
+func readEntry(url string) (cacheEntry, bool) {
+	entry := cacheEntry{}
+	if CacheDir == "" {
+		return entry, false
+	}
+
+	content, err := os.ReadFile(entryPath(url))
+	if err != nil || json.Unmarshal(content, &entry) != nil || entry.Url != url {
+		return entry, false
+	}
+
+	return entry, true
+}
+
+func writeEntry(entry cacheEntry) {
+	if CacheDir == "" {
+		return
+	}
+
+	content, err := json.Marshal(entry)
+	if err == nil {
+		err = os.MkdirAll(filepath.Join(CacheDir, "http"), os.ModeDir|os.ModePerm)
+	}
+
+	if err == nil {
+		err = WriteFile(entryPath(entry.Url), content)
+	}
+
+	if err != nil {
+		// posts are cached with their body after the url
+		url, _, _ := strings.Cut(entry.Url, "\n")
+		slog.Warn("couldn't cache "+url, "url", url, "err", err.Error())
+	}
+}
+
+// requests the url like Download, but keeps the response in the cache, asks the server if the cached one is still current
+// before downloading it again, and uses it without asking when offline
+func Get(ctx context.Context, url string) ([]byte, error) {
+	return request(ctx, http.MethodGet, url, nil)
+}
+
+// like Get, but posts body as JSON, which is cached along with the url
+func Post(ctx context.Context, url string, body []byte) ([]byte, error) {
+	return request(ctx, http.MethodPost, url, body)
+}
+
+// keeps content in the cache as the response to a GET of url, so it can be used offline even though it came from another request
+func Remember(url string, content []byte) {
+	if entry, ok := readEntry(url); !ok || !bytes.Equal(entry.Body, content) {
+		writeEntry(cacheEntry{Url: url, Body: content})
+	}
+}
+
+func request(ctx context.Context, method, url string, body []byte) ([]byte, error) {
+	key := url
+	if body != nil {
+		key += "\n" + string(body)
+	}
+
+	entry, cached := readEntry(key)
+
+	if Offline() {
+		if cached {
+			return entry.Body, nil
+		}
+
+		return []byte{}, &errs.MissingError{What: "'" + url + "'"}
+	}
+
+	logging.Trace(method+" "+url, "url", url, "cached", cached)
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return []byte{}, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if cached && entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+
+	if cached && entry.LastModified != "" {
+		req.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if noNetwork(ctx, err) {
+			goOffline(url, err)
+			return request(ctx, method, url, body)
+		}
+
+		return []byte{}, &errs.NetworkError{Url: url, Err: err}
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if cached {
+			return entry.Body, nil
+		}
+	case http.StatusOK:
+		content, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return []byte{}, &errs.NetworkError{Url: url, Err: err}
+		}
+
+		writeEntry(cacheEntry{Url: key, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified"), Body: content})
+
+		return content, nil
+	}
+
+	return []byte{}, &errs.NetworkError{Url: url, StatusCode: resp.StatusCode, Status: resp.Status}
+}
+
+func filePath(sha1 string) string {
+	return filepath.Join(CacheDir, "files", sha1[:2], sha1)
+}
+
+// a file that was kept from an earlier download, if it's there and still has the right hash
+func CachedFile(sha1 string) ([]byte, bool) {
+	if CacheDir == "" || len(sha1) < 2 {
+		return nil, false
+	}
+
+	content, err := os.ReadFile(filePath(sha1))
+	if err != nil || Sha1(content) != sha1 {
+		return nil, false
+	}
+
+	return content, true
+}
+
+// keeps a downloaded file for later, by its hash
+func CacheFile(content []byte) {
+	if CacheDir == "" {
+		return
+	}
+
+	name := filePath(Sha1(content))
+
+	if _, err := os.Stat(name); err == nil {
+		return
+	}
+
+	err := os.MkdirAll(filepath.Dir(name), os.ModeDir|os.ModePerm)
+	if err == nil {
+		err = WriteFile(name, content)
+	}
+
+	if err != nil {
+		slog.Warn("couldn't cache a download", "err", err.Error())
+	}
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/voidwyrm-2/matrix/api/errs"
+)
+
+func TestGet(t *testing.T) {
+	CacheDir = t.TempDir()
+	defer func() { CacheDir = "" }()
+
+	requests, revalidated := 0, 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"1"` {
+			revalidated++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", `"1"`)
+		w.Write([]byte("body"))
+	}))
+
+	url := srv.URL + "/project"
+
+	for i := 0; i < 2; i++ {
+		content, err := Get(context.Background(), url)
+		if err != nil {
+			t.Fatal(err.Error())
+		} else if string(content) != "body" {
+			t.Fatalf("expected `body`, but got `%s`", content)
+		}
+	}
+
+	if requests != 2 || revalidated != 1 {
+		t.Fatalf("expected the second request to be revalidated, but got %d requests and %d revalidated", requests, revalidated)
+	}
+
+	// a server that can't be reached turns offline mode on, and the cache is used instead
+	srv.Close()
+	defer SetOffline(false)
+
+	content, err := Get(context.Background(), url)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if string(content) != "body" {
+		t.Fatalf("expected the cached `body`, but got `%s`", content)
+	} else if !Offline() {
+		t.Fatal("expected to be offline")
+	}
+
+	if _, err := Get(context.Background(), srv.URL+"/other"); !errors.Is(err, errs.ErrOffline) {
+		t.Fatalf("expected ErrOffline for something that isn't cached, but got %v", err)
+	}
+}
+
+func TestCacheFile(t *testing.T) {
+	CacheDir = t.TempDir()
+	defer func() { CacheDir = "" }()
+
+	CacheFile([]byte("jar"))
+
+	if content, ok := CachedFile(Sha1([]byte("jar"))); !ok || string(content) != "jar" {
+		t.Fatalf("expected the cached file to be `jar`, but got `%s`", content)
+	}
+
+	if _, ok := CachedFile(Sha1([]byte("other"))); ok {
+		t.Fatal("expected a file that wasn't cached not to be found")
+	}
+}
@@ -1,55 +1,133 @@
 package internal
 
 import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"errors"
-	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
+
+	"github.com/voidwyrm-2/matrix/api/errs"
+	"github.com/voidwyrm-2/matrix/api/logging"
 )
 
-func Download(url string) ([]byte, error) {
-	resp, err := http.Get(url)
+func Download(ctx context.Context, url string) ([]byte, error) {
+	return DownloadProgress(ctx, url, nil)
+}
+
+// counts what's read through it
+type progressReader struct {
+	r           io.Reader
+	done, total int64
+	progress    func(done, total int64)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.done += int64(n)
+		pr.progress(pr.done, pr.total)
+	}
+
+	return n, err
+}
+
+// downloads the url, calling progress with how much has been downloaded and the size (-1 if it isn't known) if it isn't nil;
+// when offline it fails with an *errs.MissingError
+func DownloadProgress(ctx context.Context, url string, progress func(done, total int64)) ([]byte, error) {
+	if Offline() {
+		return []byte{}, &errs.MissingError{What: "'" + url + "'"}
+	}
+
+	logging.Trace("GET "+url, "url", url)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return []byte{}, err
 	}
 
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if noNetwork(ctx, err) {
+			goOffline(url, err)
+			return []byte{}, &errs.MissingError{What: "'" + url + "'"}
+		}
+
+		return []byte{}, &errs.NetworkError{Url: url, Err: err}
+	}
+
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return []byte{}, fmt.Errorf("status code %d, '%s'\n", resp.StatusCode, resp.Status)
+		return []byte{}, &errs.NetworkError{Url: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	var body io.Reader = resp.Body
+	if progress != nil {
+		body = &progressReader{r: resp.Body, total: resp.ContentLength, progress: progress}
+	}
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return []byte{}, &errs.NetworkError{Url: url, Err: err}
 	}
 
-	return io.ReadAll(resp.Body)
+	return content, nil
 }
 
+// writes the file next to where it goes and then moves it there, so it's never left half-written
 func WriteFile(name string, content []byte) error {
-	f, err := os.Create(name)
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
 	if err != nil {
 		return err
 	}
 
-	defer f.Close()
+	if _, err = f.Write(content); err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+
+	if err == nil {
+		err = os.Chmod(f.Name(), 0o644)
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+	}
 
-	_, err = f.Write(content)
 	return err
 }
 
-func ReadOptions(options ...string) ([]byte, error) {
+func Sha1(content []byte) string {
+	sum := sha1.Sum(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// reads the first of the files that exists, returning its content and name
+func ReadOptions(options ...string) ([]byte, string, error) {
 	var e error
 
 	for _, o := range options {
 		if content, err := os.ReadFile(o); err != nil {
-			if !strings.HasSuffix(err.Error(), "no such file or directory") {
-				return []byte{}, err
+			if !errors.Is(err, fs.ErrNotExist) {
+				return []byte{}, "", err
 			} else if e == nil {
 				e = err
 			}
 		} else {
-			return content, nil
+			return content, o, nil
 		}
 	}
 
-	return []byte{}, errors.New(strings.ReplaceAll(e.Error(), options[0], "'"+strings.Join(options, "' or '")+"'"))
+	return []byte{}, "", &fs.PathError{Op: "open", Path: "'" + strings.Join(options, "' or '") + "'", Err: fs.ErrNotExist}
 }
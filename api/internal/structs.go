@@ -1,13 +1,44 @@
 package internal
 
 type PublicLocalMod struct {
-	Id, Slug, Name, Desc, Version, ForceVersion, ForceLoader string `json:",omitempty"`
+	Id, Slug, Name, Desc, Version, ForceVersion, ForceLoader string   `json:",omitempty"`
+	ForceType, Type, From                                    string   `toml:",omitempty"`
+	Dependency                                               bool     `toml:",omitempty"`
+	Requires, Profiles                                       []string `toml:",omitempty"`
+	// set if the mod was listed by its id rather than its slug
+	ById bool `toml:",omitempty"`
+	// the mods tried if this one has no compatible version, and the one that ended up being used
+	Alternatives []PublicLocalMod `toml:",omitempty"`
+	Chosen       string           `toml:",omitempty"`
+	// where the mod's file was put in the instance, relative to it, and the version and file that were synced
+	File, VersionId, Url, Sha1 string `toml:",omitempty"`
 }
 
 type PublicModpack struct {
+	// the shape of the file, so older ones can be upgraded when they're read
+	Schema                                       int `toml:"schema"`
 	Name, ModpackVersion, GameVersion, Modloader string
-	Mods                                         struct {
+	ShaderLoader, DatapackDir                    string          `toml:",omitempty"`
+	Compat                                       []string        `toml:",omitempty"`
+	Overrides                                    PublicOverrides `toml:",omitempty"`
+	// the includes and excludes written in the Matrixfile, and every file that ended up being included
+	Includes, Excludes, IncludeChain []string          `toml:",omitempty"`
+	ExternalFrom                     map[string]string `toml:",omitempty"`
+	// the includes written in each profile's section
+	ProfileIncludes map[string][]string `toml:",omitempty"`
+	// the profile synced when none is given, every profile, and the profiles each external mod is in if it isn't in all of them
+	Profile          string              `toml:",omitempty"`
+	Profiles         []string            `toml:",omitempty"`
+	ExternalProfiles map[string][]string `toml:",omitempty"`
+	// the sha1 hash of each external mod when it was downloaded
+	ExternalHashes map[string]string `toml:",omitempty"`
+	Mods           struct {
 		External map[string]string
 		Mdrth    []PublicLocalMod
 	}
 }
+
+type PublicOverrides struct {
+	Common, Client, Server string            `toml:",omitempty"`
+	Hashes                 map[string]string `toml:",omitempty"`
+}
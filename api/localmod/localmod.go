@@ -1,13 +1,14 @@
 package localmod
 
 import (
+	"context"
 	_ "embed"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"slices"
 	"strings"
 
+	"github.com/voidwyrm-2/matrix/api/errs"
 	"github.com/voidwyrm-2/matrix/api/internal"
 	"github.com/voidwyrm-2/matrix/api/localmod/proc"
 	"github.com/voidwyrm-2/matrix/api/remotemod"
@@ -72,6 +73,13 @@ var nativeCustomProcs = map[string]func(s string) string{
 type LocalMod struct {
 	name, desc, id, slug, forceVersion, forceLoader string
 	version                                         version.Version
+	forceType, kind, from                           string
+	dependency, byId                                bool
+	requires, profiles                              []string
+	alternatives                                    []LocalMod
+	chosen                                          string
+	// where the mod's file was put in the instance during the last sync, and the version and file it was
+	file, versionId, url, sha1 string
 }
 
 func New(name, desc, id, slug, forceVersion, forceLoader, mVersion string) (LocalMod, error) {
@@ -87,6 +95,132 @@ func NewWithoutVersion(name, desc, id, slug, forceVersion, forceLoader string) L
 	return LocalMod{name: name, desc: desc, id: id, slug: slug, forceVersion: forceVersion, forceLoader: forceLoader}
 }
 
+// creates a mod that's only in the pack because something else requires it
+func NewDependency(id, forceLoader string) LocalMod {
+	return LocalMod{id: id, forceLoader: forceLoader, dependency: true}
+}
+
+func (lm LocalMod) IsDependency() bool {
+	return lm.dependency
+}
+
+func (lm *LocalMod) MarkDependency() {
+	lm.dependency = true
+}
+
+// whether the mod was listed by its id rather than its slug, which stays true after its slug is filled in
+func (lm LocalMod) ById() bool {
+	return lm.byId
+}
+
+func (lm *LocalMod) SetById(byId bool) {
+	lm.byId = byId
+}
+
+func (lm LocalMod) ForceType() string {
+	return lm.forceType
+}
+
+func (lm *LocalMod) SetForceType(kind string) {
+	lm.forceType = kind
+}
+
+// what the mod turned out to be during the last sync, e.g. a mod, resource pack or shader
+func (lm LocalMod) Type() string {
+	return lm.kind
+}
+
+func (lm *LocalMod) SetType(kind string) {
+	lm.kind = kind
+}
+
+// the included file the mod was listed in, empty if it was listed in the Matrixfile itself
+func (lm LocalMod) From() string {
+	return lm.from
+}
+
+func (lm *LocalMod) SetFrom(from string) {
+	lm.from = from
+}
+
+// the profiles the mod is in, empty if it's in all of them
+func (lm LocalMod) Profiles() []string {
+	return lm.profiles
+}
+
+func (lm *LocalMod) SetProfiles(profiles []string) {
+	lm.profiles = profiles
+}
+
+// the mod's file relative to the instance, with slashes, empty if it hasn't been synced
+func (lm LocalMod) File() string {
+	return lm.file
+}
+
+func (lm *LocalMod) SetFile(file string) {
+	lm.file = file
+}
+
+// the Modrinth version that was synced, and the url and sha1 hash of its file, which are empty if it hasn't been
+func (lm LocalMod) Locked() (versionId, url, sha1 string) {
+	return lm.versionId, lm.url, lm.sha1
+}
+
+func (lm *LocalMod) Lock(versionId, url, sha1 string) {
+	lm.versionId, lm.url, lm.sha1 = versionId, url, sha1
+}
+
+func (lm LocalMod) InProfile(profile string) bool {
+	return len(lm.profiles) == 0 || slices.Contains(lm.profiles, profile)
+}
+
+// the slugs of the mods this one needs, as recorded during the last sync
+func (lm LocalMod) Requires() []string {
+	return lm.requires
+}
+
+func (lm *LocalMod) SetRequires(slugs []string) {
+	lm.requires = slugs
+}
+
+// the mods tried in order if this one has no compatible version
+func (lm LocalMod) Alternatives() []LocalMod {
+	return lm.alternatives
+}
+
+func (lm *LocalMod) SetAlternatives(alternatives []LocalMod) {
+	lm.alternatives = alternatives
+}
+
+// the id or slug of the alternative used during the last sync, empty if it was this mod
+func (lm LocalMod) Chosen() string {
+	return lm.chosen
+}
+
+func (lm *LocalMod) Choose(idOrSlug string) error {
+	if idOrSlug == lm.GetIdOrSlug() {
+		idOrSlug = ""
+	} else if !slices.ContainsFunc(lm.alternatives, func(a LocalMod) bool { return a.GetIdOrSlug() == idOrSlug }) {
+		return fmt.Errorf("'%s' isn't an alternative to '%s'", idOrSlug, lm.GetIdOrSlug())
+	}
+
+	lm.alternatives = slices.Clone(lm.alternatives)
+	lm.chosen = idOrSlug
+
+	return nil
+}
+
+// the mod that's actually used, which is either this one or the chosen alternative
+func (lm *LocalMod) Active() *LocalMod {
+	for i, a := range lm.alternatives {
+		if lm.chosen != "" && a.GetIdOrSlug() == lm.chosen {
+			return &lm.alternatives[i]
+		}
+	}
+
+	return lm
+}
+
 func (lm LocalMod) GetIdOrSlug() string {
 	if lm.slug != "" {
 		return lm.slug
@@ -99,6 +233,16 @@ func (lm LocalMod) Name() string {
 	return lm.name
 }
 
+// the version that was synced, which is empty if it hasn't been
+func (lm LocalMod) Version() version.Version {
+	return lm.version
+}
+
+// whether the mod is the given project
+func (lm LocalMod) Matches(remote remotemod.RemoteMod) bool {
+	return (lm.id != "" && lm.id == remote.Id) || (lm.slug != "" && lm.slug == remote.Slug)
+}
+
 func (lm LocalMod) IsEmpty() bool {
 	return (strings.TrimSpace(lm.id) == "" && strings.TrimSpace(lm.slug) == "") || strings.TrimSpace(lm.name) == ""
 }
@@ -111,6 +255,15 @@ func (lm LocalMod) AlreadyDownloaded(m *map[string]struct{}) bool {
 }
 
 func (lm LocalMod) ToPublic() internal.PublicLocalMod {
+	alternatives := []internal.PublicLocalMod{}
+	for _, a := range lm.alternatives {
+		alternatives = append(alternatives, a.ToPublic())
+	}
+
+	if len(alternatives) == 0 {
+		alternatives = nil
+	}
+
 	return internal.PublicLocalMod{
 		Id:           lm.id,
 		Slug:         lm.slug,
@@ -119,96 +272,146 @@ func (lm LocalMod) ToPublic() internal.PublicLocalMod {
 		Version:      lm.version.String(),
 		ForceVersion: lm.forceVersion,
 		ForceLoader:  lm.forceLoader,
+		ForceType:    lm.forceType,
+		Type:         lm.kind,
+		From:         lm.from,
+		Dependency:   lm.dependency,
+		ById:         lm.byId,
+		Requires:     lm.requires,
+		Profiles:     lm.profiles,
+		Alternatives: alternatives,
+		Chosen:       lm.chosen,
+		File:         lm.file,
+		VersionId:    lm.versionId,
+		Url:          lm.url,
+		Sha1:         lm.sha1,
 	}
 }
 
-func (lm *LocalMod) Download(gameVersion, modloader string) ([]byte, string, []remotemod.RemoteModVersionDependency, error) {
-	versionToUse := remotemod.RemoteModVersion{}
+func (lm LocalMod) ForceVersion() string {
+	return lm.forceVersion
+}
 
-	if lm.forceVersion != "" {
-		log.Printf("\033[94mmod '%s' has been forced to use version '%s'\033[0m\n", lm.GetIdOrSlug(), lm.forceVersion)
+func (lm LocalMod) ForceLoader() string {
+	return lm.forceLoader
+}
 
-		if resp, err := internal.Download("https://api.modrinth.com/v2/version/" + lm.forceVersion); err != nil {
-		} else if err = json.Unmarshal(resp, &versionToUse); err != nil {
-			return []byte{}, "", []remotemod.RemoteModVersionDependency{}, err
-		}
-	} else {
-		if lm.forceLoader != "" {
-			modloader = lm.forceLoader
-			log.Printf("\033[94mmod '%s' has been forced to use the modloader '%s'\033[0m\n", lm.GetIdOrSlug(), lm.forceLoader)
-		}
+// fills in whatever the Matrixfile didn't specify from the project and the version picked for it
+func (lm *LocalMod) Apply(remote remotemod.RemoteMod, v remotemod.RemoteModVersion) {
+	if lm.IsEmpty() {
+		lm.id = remote.Id
+		lm.slug = remote.Slug
+		lm.name = remote.Title
+		lm.desc = remote.Description
+	}
+
+	// a version that can't be parsed is left empty, which only means it can't be compared with the last one synced
+	lm.version, _ = parseModVersion(remote.Slug, v.VersionNumber)
+	lm.versionId = v.Id
+
+	if len(v.Files) > 0 {
+		lm.url, lm.sha1 = v.Files[0].Url, v.Files[0].Hashes["sha1"]
+	}
+}
 
-		remote, err := remotemod.FromProject(lm.GetIdOrSlug())
-		if err != nil {
-			return []byte{}, "", []remotemod.RemoteModVersionDependency{}, err
+// downloads a file of a version, checking it against its sha1 hash if it has one and calling progress with how much has been downloaded if it isn't nil;
+// files with a hash that were downloaded before come from the cache instead
+func Download(ctx context.Context, f remotemod.RemoteModVersionFile, progress func(done, total int64)) ([]byte, error) {
+	if content, ok := internal.CachedFile(f.Hashes["sha1"]); ok {
+		if progress != nil {
+			progress(int64(len(content)), int64(len(content)))
 		}
 
-		if lm.IsEmpty() {
-			lm.id = remote.Id
-			lm.slug = remote.Slug
-			lm.name = remote.Title
-			lm.desc = remote.Description
+		return content, nil
+	}
+
+	resp, err := internal.DownloadProgress(ctx, f.Url, progress)
+	if errors.Is(err, errs.ErrOffline) {
+		return []byte{}, &errs.MissingError{What: fmt.Sprintf("file '%s'", f.Filename)}
+	} else if err != nil {
+		return []byte{}, err
+	} else if expected, ok := f.Hashes["sha1"]; ok && internal.Sha1(resp) != expected {
+		return []byte{}, errs.Errorf(errs.ErrHashMismatch, "'%s' was corrupted while downloading, its sha1 hash is %s instead of %s", f.Filename, internal.Sha1(resp), expected)
+	}
+
+	internal.CacheFile(resp)
+
+	return resp, nil
+}
+
+// the version number of a mod as something that can be compared, which needs a special case for a lot of mods;
+// an error is returned for the ones that still can't be parsed, like 'mc1.20.1-0.5.3'
+func parseModVersion(slug, s string) (v version.Version, err error) {
+	// the special cases index into the version without checking, so one they weren't written for panics
+	defer func() {
+		if r := recover(); r != nil {
+			v, err = version.Version{}, fmt.Errorf("cannot parse '%s' (from '%s') as version: %v", s, slug, r)
 		}
+	}()
 
-		if !slices.Contains(remote.GameVersions, gameVersion) {
-			return []byte{}, "", []remotemod.RemoteModVersionDependency{}, fmt.Errorf("no mods found with version %s for '%s'('%s')\n", gameVersion, lm.slug, lm.id)
-		} else if !slices.Contains(remote.Loaders, modloader) {
-			return []byte{}, "", []remotemod.RemoteModVersionDependency{}, fmt.Errorf("no mods found with modloader %s for '%s'('%s')\n", modloader, lm.slug, lm.id)
+	if ops, ok := customProcs[slug]; ok {
+		if s, err = proc.Apply(slug, s, ops); err != nil {
+			return version.Version{}, err
 		}
+	} else if f, ok := nativeCustomProcs[slug]; ok {
+		s = f(s)
+	}
 
-		filteredVersions := []remotemod.RemoteModVersion{}
+	spl, _, _ := strings.Cut(strings.ReplaceAll(s, "-", "+"), "+")
+	spl = strings.TrimPrefix(spl, "v")
 
-		for _, rm := range remote.Versions {
-			if slices.Contains(rm.GameVersions, gameVersion) && slices.Contains(rm.Loaders, modloader) {
-				filteredVersions = append(filteredVersions, rm)
-			}
-		}
+	if v, err = version.FromString(spl, ".", 20); err != nil {
+		return version.Version{}, fmt.Errorf("cannot parse '%s' (from '%s') as version: %s", s, slug, err.Error())
+	}
 
-		// why
-		parseModVersion := func(s string) version.Version {
-			if ops, ok := customProcs[lm.slug]; ok {
-				if res, err := proc.Apply(lm.slug, s, ops); err != nil {
-					panic(err.Error())
-				} else {
-					s = res
-				}
-			} else if f, ok := nativeCustomProcs[lm.slug]; ok {
-				s = f(s)
-			}
+	return v, nil
+}
 
-			spl := strings.Split(s, "+")
+// returns the versions of the project that support the given game version and one of the modloaders,
+// grouped by the order of the modloaders and newest first within each group
+func Candidates(remote remotemod.RemoteMod, gameVersion string, modloaders ...string) []remotemod.RemoteModVersion {
+	filteredVersions := []remotemod.RemoteModVersion{}
 
-			if strings.HasPrefix(spl[0], "v") {
-				spl[0] = spl[0][1:]
-			}
+	if !slices.Contains(remote.GameVersions, gameVersion) {
+		return filteredVersions
+	}
 
-			for _, spl := range strings.Split(strings.Join(strings.Split(s, "-"), "+"), "+") {
-				if strings.HasPrefix(spl, "v") {
-					spl = spl[1:]
-				}
+	seen := map[string]struct{}{}
 
-				if v, err := version.FromString(spl, ".", 20); err != nil {
-					panic(fmt.Sprintf("cannot parse '%s'(from '%s') as version because: %s", s, lm.GetIdOrSlug(), err.Error()))
-				} else {
-					return v
-				}
-			}
+	for _, modloader := range modloaders {
+		if !slices.Contains(remote.Loaders, modloader) {
+			continue
+		}
 
-			panic(fmt.Sprintf("cannot parse '%s'(from '%s') as version", s, lm.GetIdOrSlug()))
+		group := []remotemod.RemoteModVersion{}
+
+		for _, rm := range remote.Versions {
+			if _, ok := seen[rm.Id]; !ok && slices.Contains(rm.GameVersions, gameVersion) && slices.Contains(rm.Loaders, modloader) {
+				seen[rm.Id] = struct{}{}
+				group = append(group, rm)
+			}
 		}
 
-		slices.SortFunc(filteredVersions, func(a, b remotemod.RemoteModVersion) int {
-			return parseModVersion(a.VersionNumber).Cmp(parseModVersion(b.VersionNumber))
-		})
+		parsed := map[string]version.Version{}
+		for _, rm := range group {
+			if v, err := parseModVersion(remote.Slug, rm.VersionNumber); err == nil {
+				parsed[rm.Id] = v
+			}
+		}
 
-		if len(filteredVersions) == 0 {
-			return []byte{}, "", []remotemod.RemoteModVersionDependency{}, fmt.Errorf("no mods found with version %s for '%s'('%s')\n", gameVersion, lm.slug, lm.id)
+		if len(parsed) == len(group) {
+			slices.SortStableFunc(group, func(a, b remotemod.RemoteModVersion) int {
+				return parsed[b.Id].Cmp(parsed[a.Id])
+			})
+		} else {
+			// if any of them can't be compared, they're put in the order they were published in instead
+			slices.SortStableFunc(group, func(a, b remotemod.RemoteModVersion) int {
+				return strings.Compare(b.DatePublished, a.DatePublished)
+			})
 		}
 
-		versionToUse = filteredVersions[len(filteredVersions)-1]
+		filteredVersions = append(filteredVersions, group...)
 	}
 
-	resp, err := internal.Download(versionToUse.Files[0].Url)
-
-	return resp, versionToUse.Files[0].Filename, versionToUse.Dependencies, err
+	return filteredVersions
 }
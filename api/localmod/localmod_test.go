@@ -0,0 +1,45 @@
+package localmod
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/voidwyrm-2/matrix/api/remotemod"
+)
+
+func TestCandidates(t *testing.T) {
+	// the versions are listed oldest first
+	cases := []struct {
+		slug     string
+		versions []string
+		expect   string
+	}{
+		// parsed versions are newest first
+		{"lithium", []string{"0.14.0", "0.13.0"}, "0.14.0 0.13.0"},
+		// versions that can't be parsed are put in the order they were published in
+		{"plain", []string{"mc1.20.1-0.5.3", "mc1.20.1-0.5.4"}, "mc1.20.1-0.5.4 mc1.20.1-0.5.3"},
+		// a special case that doesn't fit the version doesn't crash
+		{"sodium", []string{"0.5.0", "0.6.0"}, "0.6.0 0.5.0"},
+	}
+
+	for _, c := range cases {
+		remote := remotemod.RemoteMod{Slug: c.slug, GameVersions: []string{"1.21.1"}, Loaders: []string{"fabric"}}
+		for i, n := range c.versions {
+			remote.Versions = append(remote.Versions, remotemod.RemoteModVersion{Id: n, VersionNumber: n, DatePublished: fmt.Sprintf("2024-01-%02dT00:00:00Z", i+1), GameVersions: []string{"1.21.1"}, Loaders: []string{"fabric"}})
+		}
+
+		numbers := []string{}
+		for _, v := range Candidates(remote, "1.21.1", "fabric") {
+			numbers = append(numbers, v.VersionNumber)
+		}
+
+		if result := strings.Join(numbers, " "); result != c.expect {
+			t.Fatalf("%s: expected `%s`, but got `%s`", c.slug, c.expect, result)
+		}
+	}
+
+	if _, err := parseModVersion("plain", "mc1.20.1-0.5.3"); err == nil {
+		t.Fatal("expected 'mc1.20.1-0.5.3' not to parse")
+	}
+}
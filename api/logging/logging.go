@@ -0,0 +1,139 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+const (
+	// every request that's made, shown with -vv
+	LevelTrace = slog.Level(-8)
+	// something that's being done, like a download that's started
+	LevelProgress = slog.Level(-2)
+	// something the user should know about, but that isn't a problem
+	LevelNote = slog.Level(2)
+)
+
+var levelNames = map[slog.Level]string{LevelTrace: "TRACE", LevelProgress: "PROGRESS", LevelNote: "NOTE"}
+
+// the colours matrix has always used
+var colors = map[slog.Level]string{
+	LevelTrace:      "90",
+	slog.LevelDebug: "90",
+	LevelProgress:   "93",
+	slog.LevelInfo:  "92",
+	LevelNote:       "94",
+	slog.LevelWarn:  "91",
+	slog.LevelError: "91",
+}
+
+type Options struct {
+	Level slog.Level
+	// one JSON object per event instead of text
+	Json  bool
+	Color bool
+}
+
+// whether colours should be written to the file, which they aren't if it isn't a terminal or NO_COLOR is set
+func ShouldColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+
+	return IsTerminal(f)
+}
+
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// makes the default logger write to w
+func Setup(w io.Writer, opts Options) {
+	if opts.Json {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+			Level: opts.Level,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if level, ok := a.Value.Any().(slog.Level); ok && a.Key == slog.LevelKey && len(groups) == 0 {
+					if name, ok := levelNames[level]; ok {
+						a.Value = slog.StringValue(name)
+					}
+				}
+
+				return a
+			},
+		})))
+
+		return
+	}
+
+	slog.SetDefault(slog.New(&textHandler{w: w, mu: &sync.Mutex{}, level: opts.Level, color: opts.Color}))
+}
+
+// writes the message of each event on its own line, the way matrix always has; the attributes are only for JSON
+type textHandler struct {
+	w     io.Writer
+	mu    *sync.Mutex
+	level slog.Level
+	color bool
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	line := r.Message
+	if h.color {
+		color, ok := colors[r.Level]
+		if !ok {
+			color = colors[slog.LevelError]
+		}
+
+		line = "\033[" + color + "m" + line + "\033[0m"
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err := io.WriteString(h.w, r.Time.Format("2006/01/02 15:04:05")+" "+line+"\n")
+
+	return err
+}
+
+func (h *textHandler) WithAttrs(_ []slog.Attr) slog.Handler {
+	return h
+}
+
+func (h *textHandler) WithGroup(_ string) slog.Handler {
+	return h
+}
+
+func Trace(msg string, args ...any) {
+	slog.Log(context.Background(), LevelTrace, msg, args...)
+}
+
+func Progress(msg string, args ...any) {
+	slog.Log(context.Background(), LevelProgress, msg, args...)
+}
+
+func Note(msg string, args ...any) {
+	slog.Log(context.Background(), LevelNote, msg, args...)
+}
+
+// formats a number of bytes, like 1.5MB
+func Size(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%dB", n)
+	}
+}
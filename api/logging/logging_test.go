@@ -0,0 +1,45 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLevels(t *testing.T) {
+	cases := []struct {
+		opts   Options
+		expect []string
+	}{
+		{Options{Level: LevelProgress}, []string{"working...", "done", "note", "oops"}},
+		{Options{Level: slog.LevelWarn}, []string{"oops"}},
+		{Options{Level: LevelTrace}, []string{"GET x", "working...", "done", "note", "oops"}},
+		{Options{Level: LevelProgress, Color: true}, []string{"\033[93mworking...\033[0m", "\033[92mdone\033[0m", "\033[94mnote\033[0m", "\033[91moops\033[0m"}},
+		{Options{Level: LevelProgress, Json: true}, []string{`"level":"PROGRESS","msg":"working..."`, `"level":"INFO","msg":"done","mods":2`, `"level":"NOTE","msg":"note"`, `"level":"WARN","msg":"oops"`}},
+	}
+
+	defer slog.SetDefault(slog.Default())
+
+	for i, c := range cases {
+		buf := bytes.Buffer{}
+		Setup(&buf, c.opts)
+
+		Trace("GET x")
+		Progress("working...")
+		slog.Info("done", "mods", 2)
+		Note("note")
+		slog.Warn("oops")
+
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		if len(lines) != len(c.expect) {
+			t.Fatalf("case %d: expected %d lines, but got:\n%s", i, len(c.expect), buf.String())
+		}
+
+		for j, line := range lines {
+			if !strings.Contains(line, c.expect[j]) {
+				t.Fatalf("case %d: expected line %d to contain '%s', but got '%s'", i, j, c.expect[j], line)
+			}
+		}
+	}
+}
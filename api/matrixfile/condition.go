@@ -0,0 +1,145 @@
+package matrixfile
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/voidwyrm-2/matrix/api/version"
+)
+
+// what conditions are checked against
+type Target struct {
+	Profile, Loader, GameVersion string
+}
+
+// a `<key><op><values>` after `if`, like `loader=fabric,quilt` or `game>=1.21`
+type Condition struct {
+	Pos          Pos
+	Key, Op      string
+	Values       []string
+	gameVersions []version.Version
+}
+
+var conditionOps = []string{">=", "<=", "!=", "=", ">", "<"}
+
+func (p *parser) condition(t token) (Condition, error) {
+	i := strings.IndexAny(t.text, "=!<>")
+	if i <= 0 || t.quoted {
+		return Condition{}, p.f.Errorf(t.pos, "expected a condition like 'loader=fabric' or 'game>=1.21', but found '%s'", t.text)
+	}
+
+	c := Condition{Pos: t.pos, Key: t.text[:i]}
+
+	for _, op := range conditionOps {
+		if strings.HasPrefix(t.text[i:], op) {
+			c.Op = op
+			break
+		}
+	}
+
+	rest := t.text[i+len(c.Op):]
+	if c.Op == "" || rest == "" {
+		return Condition{}, p.f.Errorf(t.pos, "expected a condition like 'loader=fabric' or 'game>=1.21', but found '%s'", t.text)
+	}
+
+	c.Values = strings.Split(rest, ",")
+
+	switch c.Key {
+	case "minecraft":
+		c.Key = "game"
+		fallthrough
+	case "game":
+		for _, v := range c.Values {
+			gv, err := version.FromString(v, ".", 10)
+			if err != nil {
+				return Condition{}, p.f.Errorf(t.pos, "'%s' isn't a valid game version", v)
+			}
+
+			c.gameVersions = append(c.gameVersions, gv)
+		}
+
+		if len(c.Values) > 1 && c.Op != "=" && c.Op != "!=" {
+			return Condition{}, p.f.Errorf(t.pos, "only '=' and '!=' can be given more than one version")
+		}
+	case "loader":
+		if c.Op != "=" && c.Op != "!=" {
+			return Condition{}, p.f.Errorf(t.pos, "loaders can only be compared with '=' or '!='")
+		}
+
+		for i := range c.Values {
+			c.Values[i] = strings.ToLower(c.Values[i])
+		}
+	default:
+		return Condition{}, p.f.Errorf(t.pos, "unknown condition '%s', expected 'loader' or 'game'", c.Key)
+	}
+
+	return c, nil
+}
+
+func (c Condition) Holds(target Target) (bool, error) {
+	if c.Key == "loader" {
+		return slices.Contains(c.Values, target.Loader) == (c.Op == "="), nil
+	}
+
+	gv, err := version.FromString(target.GameVersion, ".", 10)
+	if err != nil {
+		return false, err
+	}
+
+	switch c.Op {
+	case "=", "!=":
+		found := slices.ContainsFunc(c.gameVersions, func(v version.Version) bool { return gv.Compare(v) == 0 })
+		return found == (c.Op == "="), nil
+	}
+
+	cmp := gv.Compare(c.gameVersions[0])
+
+	switch c.Op {
+	case ">=":
+		return cmp >= 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp < 0, nil
+	}
+}
+
+func (c Condition) String() string {
+	return c.Key + c.Op + strings.Join(c.Values, ",")
+}
+
+// splits the conditions after `if` off of a line
+func (p *parser) conditions(tokens []token) ([]token, []Condition, error) {
+	i := slices.IndexFunc(tokens, func(t token) bool { return t.text == "if" && !t.quoted })
+	if i <= 0 {
+		return tokens, nil, nil
+	} else if i == len(tokens)-1 {
+		return nil, nil, p.f.Errorf(tokens[i].pos, "expected conditions after 'if'")
+	}
+
+	conds := []Condition{}
+
+	for _, t := range tokens[i+1:] {
+		c, err := p.condition(t)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		conds = append(conds, c)
+	}
+
+	return tokens[:i], conds, nil
+}
+
+// whether every condition on the node holds for the target, nodes that can't have conditions always do
+func Holds(n Node, target Target) (bool, error) {
+	for _, c := range Conditions(n) {
+		if ok, err := c.Holds(target); err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
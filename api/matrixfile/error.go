@@ -0,0 +1,60 @@
+package matrixfile
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/voidwyrm-2/matrix/api/errs"
+)
+
+type Pos struct {
+	// the file the position is in, which matters once includes are merged in
+	File      string
+	Line, Col int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+type Error struct {
+	File string
+	Pos  Pos
+	Msg  string
+	// the line the error is on, used to point at the problem
+	Source string
+	// what went wrong if it wasn't the Matrixfile itself, like an include that couldn't be downloaded
+	Err error
+}
+
+func newError(file string, pos Pos, source, format string, a ...any) *Error {
+	return &Error{File: file, Pos: pos, Msg: fmt.Sprintf(format, a...), Source: source}
+}
+
+// only a parse error if there's no other cause, otherwise it's whatever the cause is
+func (e *Error) Is(target error) bool {
+	return e.Err == nil && target == errs.ErrParse
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("%s:%s: %s", e.File, e.Pos, e.Msg)
+	}
+
+	caret := strings.Builder{}
+	for i, r := range []rune(e.Source) {
+		if i >= e.Pos.Col-1 {
+			break
+		} else if r == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+
+	return fmt.Sprintf("%s:%s: %s\n    %s\n    %s^", e.File, e.Pos, e.Msg, e.Source, caret.String())
+}
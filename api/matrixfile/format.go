@@ -0,0 +1,310 @@
+package matrixfile
+
+import (
+	"slices"
+	"strings"
+)
+
+// the order settings are written in, which starts with the header
+var settingOrder = []string{"name", "version", "game", "loader", "shaderloader", "datapacks"}
+
+var flagOrder = []string{"v", "l", "t"}
+
+type formatItem struct {
+	// the comments on the lines above it
+	lead []string
+	text string
+	// what mods are sorted by, empty for anything that can't be moved
+	sortKey string
+	blank   bool
+}
+
+func (it formatItem) lines() []string {
+	if it.blank {
+		return []string{""}
+	}
+
+	return append(slices.Clone(it.lead), it.text)
+}
+
+type formatSection struct {
+	header                          formatItem
+	settings, directives, body, ext []formatItem
+	trailing                        []string
+}
+
+// quotes a token if it wouldn't be read back as it is
+func quote(s string) string {
+	if s != "" && s != "if" && !strings.ContainsAny(s, " \t\"#|\\") {
+		return s
+	}
+
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func withComment(text, comment string) string {
+	if comment == "" {
+		return text
+	}
+
+	return text + " # " + comment
+}
+
+func formatConditions(conds []Condition) string {
+	if len(conds) == 0 {
+		return ""
+	}
+
+	texts := []string{}
+	for _, c := range conds {
+		texts = append(texts, c.String())
+	}
+
+	return " if " + strings.Join(texts, " ")
+}
+
+func formatMod(e Entry) string {
+	text := quote(e.Slug)
+	if e.Slug == "" {
+		text = "id " + quote(e.Id)
+	}
+
+	flags := slices.Clone(e.Flags)
+	slices.SortStableFunc(flags, func(a, b Flag) int {
+		ai, bi := slices.Index(flagOrder, a.Key), slices.Index(flagOrder, b.Key)
+		if ai == -1 {
+			ai = len(flagOrder)
+		}
+
+		if bi == -1 {
+			bi = len(flagOrder)
+		}
+
+		if ai != bi {
+			return ai - bi
+		}
+
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	// only the value is quoted, `"v:1.0 beta"` wouldn't be a flag
+	for _, f := range flags {
+		text += " " + f.Key + ":"
+		if f.Value != "" {
+			text += quote(f.Value)
+		}
+	}
+
+	return text
+}
+
+// writes a single node, settings are written like `shaderloader iris` in files with the four line header
+func nodeText(n Node, legacy bool) string {
+	switch n := n.(type) {
+	case Comment:
+		return strings.TrimSpace("# " + n.Text)
+	case Setting:
+		value := n.Value
+		if n.Key == "loader" || n.Key == "shaderloader" {
+			value = strings.ToLower(value)
+		}
+
+		if legacy {
+			return withComment(n.Key+" "+quote(value), n.Comment)
+		}
+
+		return withComment(n.Key+" = "+quote(value), n.Comment)
+	case Directive:
+		args := []string{}
+		for _, a := range n.Args {
+			args = append(args, quote(a))
+		}
+
+		return withComment(n.Name+" "+strings.Join(args, " "), n.Comment)
+	case Include:
+		return withComment("include "+quote(n.Target)+formatConditions(n.If), n.Comment)
+	case Exclude:
+		return withComment("-"+n.Key+formatConditions(n.If), n.Comment)
+	case External:
+		return withComment("ext "+quote(n.Name)+" "+quote(n.Url)+formatConditions(n.If), n.Comment)
+	case Entry:
+		return formatEntry(n)
+	case Profile:
+		return withComment("[profile "+n.Name+"]", n.Comment)
+	}
+
+	return ""
+}
+
+func formatEntry(e Entry) string {
+	text := formatMod(e)
+
+	for _, a := range e.Alternatives {
+		text += " | " + formatMod(a)
+	}
+
+	for _, p := range e.Profiles {
+		text += " @" + p
+	}
+
+	return withComment(text+formatConditions(e.If), e.Comment)
+}
+
+// writes the file in its canonical form, the modern header first, then the other settings, directives, mods and external mods,
+// keeping comments with the line below them. Mods are sorted between blank lines, includes and excludes if sorted is true.
+// Only the file itself is formatted, not what it includes
+func (f *File) Format(sorted bool) []byte {
+	root := &formatSection{}
+	sections := []*formatSection{root}
+	cur := root
+
+	preamble, pending := []string{}, []string{}
+	seenNode := false
+
+	add := func(list *[]formatItem, text, sortKey string) {
+		*list = append(*list, formatItem{lead: pending, text: text, sortKey: sortKey})
+		pending = []string{}
+		seenNode = true
+	}
+
+	for _, n := range f.Nodes {
+		switch n := n.(type) {
+		case Comment:
+			pending = append(pending, strings.TrimSpace("# "+n.Text))
+		case Blank:
+			if len(pending) > 0 && !seenNode {
+				preamble = append(preamble, pending...)
+				pending = []string{}
+			} else if len(pending) > 0 {
+				cur.body = append(cur.body, formatItem{text: strings.Join(pending, "\n")})
+				pending = []string{}
+			}
+
+			if len(cur.body) > 0 && !cur.body[len(cur.body)-1].blank {
+				cur.body = append(cur.body, formatItem{blank: true})
+			}
+		case Setting:
+			add(&cur.settings, nodeText(n, false), n.Key)
+		case Directive:
+			add(&cur.directives, nodeText(n, false), "")
+		case Include, Exclude:
+			add(&cur.body, nodeText(n, false), "")
+		case External:
+			add(&cur.ext, nodeText(n, false), "")
+		case Entry:
+			add(&cur.body, nodeText(n, false), n.IdOrSlug())
+		case Profile:
+			cur = &formatSection{header: formatItem{lead: pending, text: nodeText(n, false)}}
+			sections = append(sections, cur)
+			pending = []string{}
+			seenNode = true
+		}
+	}
+
+	cur.trailing = pending
+
+	if f.Legacy {
+		header := []formatItem{}
+		for _, s := range [][2]string{{"name", f.Header.Name}, {"version", f.Header.Version}, {"game", f.Header.GameVersion}, {"loader", f.Header.Loader}} {
+			header = append(header, formatItem{text: s[0] + " = " + quote(s[1]), sortKey: s[0]})
+		}
+
+		root.settings = append(header, root.settings...)
+	}
+
+	slices.SortStableFunc(root.settings, func(a, b formatItem) int {
+		return slices.Index(settingOrder, a.sortKey) - slices.Index(settingOrder, b.sortKey)
+	})
+
+	// each group is separated by a blank line, except for a profile and its mods
+	groups := [][]string{}
+	joined := []bool{}
+
+	join := false
+
+	push := func(lines []string) {
+		if len(lines) > 0 {
+			groups = append(groups, lines)
+			joined = append(joined, join)
+			join = false
+		}
+	}
+
+	push(preamble)
+
+	for i, s := range sections {
+		if i > 0 {
+			push(s.header.lines())
+			join = true
+		}
+
+		if sorted {
+			sortMods(s.body)
+		}
+
+		for _, list := range [][]formatItem{s.settings, s.directives, trimBlanks(s.body), s.ext} {
+			group := []string{}
+			for _, it := range list {
+				group = append(group, it.lines()...)
+			}
+
+			push(group)
+		}
+
+		push(s.trailing)
+		join = false
+	}
+
+	out := []string{}
+	for i, g := range groups {
+		if i > 0 && !joined[i] {
+			out = append(out, "")
+		}
+
+		out = append(out, g...)
+	}
+
+	return []byte(strings.Join(out, "\n") + "\n")
+}
+
+func trimBlanks(items []formatItem) []formatItem {
+	for len(items) > 0 && items[0].blank {
+		items = items[1:]
+	}
+
+	for len(items) > 0 && items[len(items)-1].blank {
+		items = items[:len(items)-1]
+	}
+
+	return items
+}
+
+// sorts each run of mods, which is broken up by anything that can't be moved
+func sortMods(items []formatItem) {
+	for start := 0; start < len(items); {
+		end := start
+		for end < len(items) && items[end].sortKey != "" {
+			end++
+		}
+
+		slices.SortStableFunc(items[start:end], func(a, b formatItem) int {
+			return strings.Compare(a.sortKey, b.sortKey)
+		})
+
+		start = end + 1
+	}
+}
+
+// writes the nodes as they are, in order, with the four line header if the file uses it
+func (f *File) Bytes() []byte {
+	lines := []string{}
+	if f.Legacy {
+		lines = append(lines, f.Header.Name, f.Header.Version, f.Header.GameVersion, f.Header.Loader)
+	}
+
+	for _, n := range f.Nodes {
+		lines = append(lines, nodeText(n, f.Legacy))
+	}
+
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
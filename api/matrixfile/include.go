@@ -0,0 +1,252 @@
+package matrixfile
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/voidwyrm-2/matrix/api/errs"
+	"github.com/voidwyrm-2/matrix/api/internal"
+)
+
+// reads the target of an include, returning a name that identifies it no matter how it was written
+type IncludeReader func(from, target string) (string, []byte, error)
+
+// whether an include or the file it's in is a http or https URL, rather than a path
+func IsUrl(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// reads includes from disk relative to the including file, or downloads them if they're URLs
+func ReadInclude(ctx context.Context) IncludeReader {
+	return func(from, target string) (string, []byte, error) {
+		if IsUrl(from) && !IsUrl(target) {
+			base, err := url.Parse(from)
+			if err != nil {
+				return "", nil, err
+			}
+
+			ref, err := url.Parse(target)
+			if err != nil {
+				return "", nil, err
+			}
+
+			target = base.ResolveReference(ref).String()
+		}
+
+		if IsUrl(target) {
+			content, err := internal.Get(ctx, target)
+			return target, content, err
+		}
+
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(from), target)
+		}
+
+		content, err := os.ReadFile(target)
+
+		return filepath.Clean(target), content, err
+	}
+}
+
+type flattener struct {
+	read   IncludeReader
+	target Target
+	out    *File
+	chain  []string
+	// the files currently being included, to catch cycles
+	stack []string
+}
+
+// returns the file with its includes, excludes, conditions and the target's profile ("" for none) applied, and every file that was included, in order.
+// Mods that are listed again replace the earlier entry, keeping its place
+func (f *File) Flatten(read IncludeReader, target Target) (*File, []string, error) {
+	if target.Loader == "" {
+		target.Loader = f.Header.Loader
+	}
+
+	if target.GameVersion == "" {
+		target.GameVersion = f.Header.GameVersion
+	}
+
+	fl := flattener{read: read, target: target, out: &File{Path: f.Path, Header: f.Header, Legacy: f.Legacy, Profiles: slices.Clone(f.Profiles), sources: map[string][]string{}}, stack: []string{filepath.Clean(f.Path)}}
+
+	for k, v := range f.sources {
+		fl.out.sources[k] = v
+	}
+
+	index := map[string]int{}
+
+	if err := fl.merge(f, index, true); err != nil {
+		return nil, nil, err
+	}
+
+	nodes := []Node{}
+	for _, n := range fl.out.Nodes {
+		if n != nil {
+			nodes = append(nodes, n)
+		}
+	}
+
+	fl.out.Nodes = nodes
+
+	if target.Profile != "" && !slices.Contains(fl.out.Profiles, target.Profile) {
+		return nil, nil, errs.Errorf(errs.ErrNotFound, "%s: profile '%s' isn't used anywhere", f.Path, target.Profile)
+	}
+
+	return fl.out, fl.chain, nil
+}
+
+// the conditions on a node, nil for nodes that can't have any
+func Conditions(n Node) []Condition {
+	switch n := n.(type) {
+	case Entry:
+		return n.If
+	case External:
+		return n.If
+	case Include:
+		return n.If
+	case Exclude:
+		return n.If
+	}
+
+	return nil
+}
+
+// checks the conditions of a node against the target
+func (fl *flattener) holds(f *File, n Node) (bool, error) {
+	for _, c := range Conditions(n) {
+		ok, err := c.Holds(fl.target)
+		if err != nil {
+			return false, f.Errorf(c.Pos, "can't check '%s' against game version '%s'", c, fl.target.GameVersion)
+		} else if !ok {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// puts the shared nodes first, then the ones for the profile, leaving out the ones for any other profile and the ones whose conditions don't hold
+func (fl *flattener) selectNodes(f *File) ([]Node, error) {
+	shared, selected := []Node{}, []Node{}
+	section := ""
+
+	for _, n := range f.Nodes {
+		if p, ok := n.(Profile); ok {
+			section = p.Name
+			continue
+		} else if e, ok := n.(Entry); ok && len(e.Profiles) > 0 && !slices.Contains(e.Profiles, fl.target.Profile) {
+			continue
+		}
+
+		if ok, err := fl.holds(f, n); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		if section == "" {
+			shared = append(shared, n)
+		} else if section == fl.target.Profile {
+			selected = append(selected, n)
+		}
+	}
+
+	return append(shared, selected...), nil
+}
+
+func entryKey(e Entry) string {
+	return "mod:" + e.IdOrSlug()
+}
+
+func (fl *flattener) merge(f *File, index map[string]int, root bool) error {
+	nodes, err := fl.selectNodes(f)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case Include:
+			if err := fl.include(f, n, index); err != nil {
+				return err
+			}
+		case Exclude:
+			found := false
+
+			for _, key := range []string{"mod:" + n.Key, "ext:" + n.Key} {
+				if i, ok := index[key]; ok {
+					fl.out.Nodes[i] = nil
+					delete(index, key)
+					found = true
+				}
+			}
+
+			if !found {
+				return f.Errorf(n.Pos, "'%s' doesn't match any mod included before it", n.Key)
+			}
+		case Entry:
+			fl.put(entryKey(n), n, index)
+		case External:
+			fl.put("ext:"+n.Name, n, index)
+		default:
+			// comments and blank lines of included files aren't kept
+			if root {
+				fl.out.Nodes = append(fl.out.Nodes, n)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (fl *flattener) put(key string, n Node, index map[string]int) {
+	if i, ok := index[key]; ok {
+		fl.out.Nodes[i] = n
+	} else {
+		index[key] = len(fl.out.Nodes)
+		fl.out.Nodes = append(fl.out.Nodes, n)
+	}
+}
+
+func (fl *flattener) include(from *File, inc Include, index map[string]int) error {
+	name, content, err := fl.read(inc.Pos.File, inc.Target)
+	if err != nil {
+		e := from.Errorf(inc.Pos, "couldn't include '%s': %s", inc.Target, strings.TrimSpace(err.Error())).(*Error)
+		e.Err = err
+
+		return e
+	}
+
+	for i, s := range fl.stack {
+		if s == name {
+			return from.Errorf(inc.Pos, "include cycle: %s -> %s", strings.Join(fl.stack[i:], " -> "), name)
+		}
+	}
+
+	f, err := ParseFragment(name, content)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range f.sources {
+		fl.out.sources[k] = v
+	}
+
+	for _, p := range f.Profiles {
+		if !slices.Contains(fl.out.Profiles, p) {
+			fl.out.Profiles = append(fl.out.Profiles, p)
+		}
+	}
+
+	fl.chain = append(fl.chain, name)
+	fl.stack = append(fl.stack, name)
+	defer func() { fl.stack = fl.stack[:len(fl.stack)-1] }()
+
+	return fl.merge(f, index, false)
+}
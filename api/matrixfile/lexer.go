@@ -0,0 +1,97 @@
+package matrixfile
+
+import (
+	"strings"
+	"unicode"
+)
+
+type token struct {
+	text   string
+	pos    Pos
+	quoted bool
+}
+
+type line struct {
+	num    int
+	tokens []token
+	// the line without its comment, for the parts of the legacy header that can contain spaces
+	raw        string
+	comment    string
+	commentPos Pos
+	hasComment bool
+}
+
+func (l line) empty() bool {
+	return len(l.tokens) == 0
+}
+
+func lex(name, src string) ([]line, []string, error) {
+	sourceLines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	lines := []line{}
+
+	for i, sl := range sourceLines {
+		l := line{num: i + 1}
+		runes := []rune(sl)
+
+		errf := func(col int, format string, a ...any) error {
+			return newError(name, Pos{File: name, Line: i + 1, Col: col + 1}, sourceLines[i], format, a...)
+		}
+
+		for c := 0; c < len(runes); {
+			r := runes[c]
+
+			switch {
+			case unicode.IsSpace(r):
+				c++
+			case r == '#':
+				l.comment = strings.TrimSpace(string(runes[c+1:]))
+				l.commentPos = Pos{File: name, Line: i + 1, Col: c + 1}
+				l.hasComment = true
+				l.raw = string(runes[:c])
+				c = len(runes)
+			case r == '"':
+				start := c
+				text := strings.Builder{}
+				closed := false
+
+				for c++; c < len(runes); c++ {
+					if runes[c] == '\\' && c+1 < len(runes) {
+						c++
+						text.WriteRune(runes[c])
+					} else if runes[c] == '"' {
+						closed = true
+						c++
+						break
+					} else {
+						text.WriteRune(runes[c])
+					}
+				}
+
+				if !closed {
+					return nil, nil, errf(start, "unterminated string")
+				}
+
+				l.tokens = append(l.tokens, token{text: text.String(), pos: Pos{File: name, Line: i + 1, Col: start + 1}, quoted: true})
+			case r == '|':
+				l.tokens = append(l.tokens, token{text: "|", pos: Pos{File: name, Line: i + 1, Col: c + 1}})
+				c++
+			default:
+				start := c
+				for c < len(runes) && !unicode.IsSpace(runes[c]) && runes[c] != '"' && runes[c] != '|' {
+					c++
+				}
+
+				l.tokens = append(l.tokens, token{text: string(runes[start:c]), pos: Pos{File: name, Line: i + 1, Col: start + 1}})
+			}
+		}
+
+		if !l.hasComment {
+			l.raw = sl
+		}
+
+		l.raw = strings.TrimSpace(l.raw)
+		lines = append(lines, l)
+	}
+
+	return lines, sourceLines, nil
+}
@@ -0,0 +1,165 @@
+package matrixfile
+
+import (
+	"slices"
+)
+
+type mergeNode struct {
+	n       Node
+	section string
+	used    bool
+}
+
+// returns the file changed to match gen, a Matrixfile with the same meaning as the one the file should have now.
+// Comments, blank lines and the order of whatever is still in it are kept, nodes whose conditions don't hold for the target are kept as they are,
+// and anything new is added to the end of its section
+func (f *File) Merge(gen *File, target Target) *File {
+	out := &File{Path: f.Path, Header: gen.Header, Legacy: f.Legacy, Profiles: slices.Clone(gen.Profiles), sources: f.sources}
+
+	nodes := []*mergeNode{}
+	section := ""
+
+	for _, n := range gen.Nodes {
+		if p, ok := n.(Profile); ok {
+			section = p.Name
+			continue
+		}
+
+		// the four line header can't be written as settings
+		s, ok := n.(Setting)
+		nodes = append(nodes, &mergeNode{n: n, section: section, used: ok && f.Legacy && slices.Contains(settingOrder[:4], s.Key)})
+	}
+
+	find := func(match func(m *mergeNode) bool) *mergeNode {
+		for _, m := range nodes {
+			if !m.used && match(m) {
+				m.used = true
+				return m
+			}
+		}
+
+		return nil
+	}
+
+	// adds what's left of a section before the blank lines and comments at the end of it
+	flush := func(section string) {
+		end := len(out.Nodes)
+		for end > 0 {
+			if _, ok := out.Nodes[end-1].(Blank); ok {
+				end--
+			} else if _, ok := out.Nodes[end-1].(Comment); ok {
+				end--
+			} else {
+				break
+			}
+		}
+
+		added := []Node{}
+		for _, m := range nodes {
+			if !m.used && m.section == section {
+				m.used = true
+				added = append(added, m.n)
+			}
+		}
+
+		out.Nodes = append(out.Nodes[:end], append(added, out.Nodes[end:]...)...)
+	}
+
+	section = ""
+
+	for _, n := range f.Nodes {
+		if ok, err := Holds(n, target); err != nil || !ok {
+			out.Nodes = append(out.Nodes, n)
+			continue
+		}
+
+		switch n := n.(type) {
+		case Comment, Blank:
+			out.Nodes = append(out.Nodes, n)
+		case Profile:
+			flush(section)
+			section = n.Name
+			out.Nodes = append(out.Nodes, n)
+		case Setting:
+			if m := find(func(m *mergeNode) bool {
+				s, ok := m.n.(Setting)
+				return ok && s.Key == n.Key
+			}); m != nil {
+				s := m.n.(Setting)
+				s.Comment = n.Comment
+				out.Nodes = append(out.Nodes, s)
+			}
+		case Directive:
+			if find(func(m *mergeNode) bool {
+				d, ok := m.n.(Directive)
+				return ok && m.section == section && d.Name == n.Name && slices.Equal(d.Args, n.Args)
+			}) != nil {
+				out.Nodes = append(out.Nodes, n)
+			}
+		case Include:
+			if find(func(m *mergeNode) bool {
+				i, ok := m.n.(Include)
+				return ok && m.section == section && i.Target == n.Target
+			}) != nil {
+				out.Nodes = append(out.Nodes, n)
+			}
+		case Exclude:
+			if find(func(m *mergeNode) bool {
+				e, ok := m.n.(Exclude)
+				return ok && m.section == section && e.Key == n.Key
+			}) != nil {
+				out.Nodes = append(out.Nodes, n)
+			}
+		case External:
+			if m := find(func(m *mergeNode) bool {
+				e, ok := m.n.(External)
+				return ok && m.section == section && e.Name == n.Name
+			}); m != nil {
+				e := m.n.(External)
+				e.Pos, e.If, e.Comment = n.Pos, n.If, n.Comment
+				out.Nodes = append(out.Nodes, e)
+			}
+		case Entry:
+			var e Entry
+
+			if find(func(m *mergeNode) bool {
+				ge, ok := m.n.(Entry)
+				if !ok || ge.Id != n.Id || ge.Slug != n.Slug {
+					return false
+				}
+
+				e = ge
+				switch {
+				case m.section == section:
+					return true
+				case section == "" && len(ge.Profiles) == 0:
+					// a mod only in one profile can be tagged instead of being in its section
+					e.Profiles = []string{m.section}
+					return true
+				case m.section == "" && len(ge.Profiles) == 1 && ge.Profiles[0] == section:
+					e.Profiles = nil
+					return true
+				}
+
+				return false
+			}) != nil {
+				e.Pos, e.If, e.Comment = n.Pos, n.If, n.Comment
+				out.Nodes = append(out.Nodes, e)
+			}
+		}
+	}
+
+	flush(section)
+
+	for _, p := range gen.Nodes {
+		if p, ok := p.(Profile); ok && !slices.ContainsFunc(f.Nodes, func(n Node) bool {
+			o, ok := n.(Profile)
+			return ok && o.Name == p.Name
+		}) {
+			out.Nodes = append(out.Nodes, Blank{}, p)
+			flush(p.Name)
+		}
+	}
+
+	return out
+}
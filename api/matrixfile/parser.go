@@ -0,0 +1,548 @@
+package matrixfile
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/voidwyrm-2/matrix/api/internal"
+)
+
+type Node interface {
+	Position() Pos
+}
+
+// a line that only has a comment on it
+type Comment struct {
+	Pos  Pos
+	Text string
+}
+
+type Blank struct {
+	Pos Pos
+}
+
+// a `key = value` line
+type Setting struct {
+	Pos        Pos
+	Key, Value string
+	Comment    string
+}
+
+type External struct {
+	Pos       Pos
+	Name, Url string
+	If        []Condition
+	Comment   string
+}
+
+// a line starting with a keyword like `compat` or `overrides`, whose arguments are checked by whatever uses it
+type Directive struct {
+	Pos     Pos
+	Name    string
+	Args    []string
+	ArgPos  []Pos
+	Comment string
+}
+
+// an `include <path or url>` line, which merges another file's mods in at that point
+type Include struct {
+	Pos     Pos
+	Target  string
+	If      []Condition
+	Comment string
+}
+
+// a `-<slug or id>` line, which removes a mod (or external mod) that was included before it
+type Exclude struct {
+	Pos     Pos
+	Key     string
+	If      []Condition
+	Comment string
+}
+
+// a `[profile <name>]` line, everything after it until the next one is only used for that profile
+type Profile struct {
+	Pos     Pos
+	Name    string
+	Comment string
+}
+
+type Flag struct {
+	Pos        Pos
+	Key, Value string
+}
+
+type Entry struct {
+	Pos      Pos
+	Id, Slug string
+	Flags    []Flag
+	// the profiles given with `@<profile>`, the entry is only used for those if there are any
+	Profiles []string
+	// the mods tried in order if this one has no compatible version, each with their own flags
+	Alternatives []Entry
+	// the entry is only used if all of these hold
+	If      []Condition
+	Comment string
+}
+
+func (n Comment) Position() Pos   { return n.Pos }
+func (n Blank) Position() Pos     { return n.Pos }
+func (n Setting) Position() Pos   { return n.Pos }
+func (n External) Position() Pos  { return n.Pos }
+func (n Directive) Position() Pos { return n.Pos }
+func (n Entry) Position() Pos     { return n.Pos }
+func (n Include) Position() Pos   { return n.Pos }
+func (n Exclude) Position() Pos   { return n.Pos }
+func (n Profile) Position() Pos   { return n.Pos }
+
+func (e Entry) IdOrSlug() string {
+	if e.Slug != "" {
+		return e.Slug
+	}
+
+	return e.Id
+}
+
+func (e Entry) Flag(key string) (Flag, bool) {
+	for _, f := range e.Flags {
+		if f.Key == key {
+			return f, true
+		}
+	}
+
+	return Flag{}, false
+}
+
+type Header struct {
+	Name, Version, GameVersion, Loader string
+}
+
+type File struct {
+	Path   string
+	Header Header
+	// the file uses the original format, where the first four lines are the header
+	Legacy bool
+	Nodes  []Node
+	// every profile that's mentioned, in order
+	Profiles []string
+	// the lines of every file the nodes came from
+	sources map[string][]string
+}
+
+// creates an error pointing at the given position
+func (f *File) Errorf(pos Pos, format string, a ...any) error {
+	if pos.File == "" {
+		pos.File = f.Path
+	}
+
+	source := ""
+	if lines := f.sources[pos.File]; pos.Line > 0 && pos.Line <= len(lines) {
+		source = lines[pos.Line-1]
+	}
+
+	return newError(pos.File, pos, source, format, a...)
+}
+
+// the names a Matrixfile can have, in the order they're looked for
+var names = []string{"Matrixfile", "matrixfile", "Matrixfile.txt", "matrixfile.txt"}
+
+var settingAliases = map[string]string{
+	"name":         "name",
+	"version":      "version",
+	"game":         "game",
+	"minecraft":    "game",
+	"loader":       "loader",
+	"modloader":    "loader",
+	"shaderloader": "shaderloader",
+	"datapacks":    "datapacks",
+}
+
+var legacyFormat = `expected
+<name>
+<pack version>
+<Minecraft version>
+<modloader>
+
+(<slug> OR id <id>) [flags...]
+...`
+
+type parser struct {
+	f       *File
+	section string
+	// included files only list mods, so they don't have a header
+	fragment bool
+}
+
+// parses the Matrixfile at the given path, also returning its contents.
+// If the path is a folder, or empty for the working directory, the Matrixfile is looked for in it
+func Open(path string) (*File, []byte, error) {
+	options := []string{path}
+	if info, err := os.Stat(path); path == "" || (err == nil && info.IsDir()) {
+		options = []string{}
+		for _, name := range names {
+			options = append(options, filepath.Join(path, name))
+		}
+	}
+
+	content, path, err := internal.ReadOptions(options...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := Parse(path, content)
+
+	return f, content, err
+}
+
+// writes a Matrixfile to path all at once, so it's never left half written
+func WriteFile(path string, content []byte) error {
+	return internal.WriteFile(path, content)
+}
+
+func Parse(path string, src []byte) (*File, error) {
+	return parse(path, src, false)
+}
+
+// parses a file meant to be included by another Matrixfile
+func ParseFragment(path string, src []byte) (*File, error) {
+	return parse(path, src, true)
+}
+
+func parse(path string, src []byte, fragment bool) (*File, error) {
+	lines, source, err := lex(path, string(src))
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{f: &File{Path: path, sources: map[string][]string{path: source}}, fragment: fragment}
+
+	for _, l := range lines {
+		if fragment {
+			break
+		}
+
+		if !l.empty() {
+			_, isSetting := splitSetting(l)
+			p.f.Legacy = !isSetting
+			break
+		}
+	}
+
+	if p.f.Legacy {
+		lines, err = p.legacyHeader(lines)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, l := range lines {
+		if err := p.line(l); err != nil {
+			return nil, err
+		}
+	}
+
+	if !p.f.Legacy && !fragment {
+		for _, s := range [][2]string{{"name", p.f.Header.Name}, {"version", p.f.Header.Version}, {"game", p.f.Header.GameVersion}, {"loader", p.f.Header.Loader}} {
+			if s[1] == "" {
+				return nil, p.f.Errorf(Pos{File: path, Line: 1, Col: 1}, "missing the '%s' setting", s[0])
+			}
+		}
+	}
+
+	return p.f, nil
+}
+
+// takes the first four lines as the header and returns the rest
+func (p *parser) legacyHeader(lines []line) ([]line, error) {
+	header := []*string{&p.f.Header.Name, &p.f.Header.Version, &p.f.Header.GameVersion, &p.f.Header.Loader}
+	found := 0
+
+	for i, l := range lines {
+		if found == len(header) {
+			return lines[i:], nil
+		}
+
+		if l.empty() {
+			if err := p.line(l); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		*header[found] = l.raw
+		found++
+
+		if found == len(header) {
+			p.f.Header.Loader = strings.ToLower(p.f.Header.Loader)
+		}
+
+		if l.hasComment {
+			p.f.Nodes = append(p.f.Nodes, Comment{Pos: l.commentPos, Text: l.comment})
+		}
+	}
+
+	if found < len(header) {
+		return nil, p.f.Errorf(Pos{File: p.f.Path, Line: len(lines), Col: 1}, "invalid Matrixfile format, %s", legacyFormat)
+	}
+
+	return []line{}, nil
+}
+
+// returns the key and value tokens if the line is a `key = value` line
+func splitSetting(l line) ([2]token, bool) {
+	if len(l.tokens) == 0 || l.tokens[0].quoted {
+		return [2]token{}, false
+	}
+
+	first := l.tokens[0]
+
+	if k, v, ok := strings.Cut(first.text, "="); ok {
+		key := token{text: k, pos: first.pos}
+
+		if v != "" && len(l.tokens) == 1 {
+			return [2]token{key, {text: v, pos: Pos{File: first.pos.File, Line: first.pos.Line, Col: first.pos.Col + len([]rune(k)) + 1}}}, true
+		} else if v == "" && len(l.tokens) == 2 {
+			return [2]token{key, l.tokens[1]}, true
+		}
+	} else if len(l.tokens) == 3 && l.tokens[1].text == "=" && !l.tokens[1].quoted {
+		return [2]token{first, l.tokens[2]}, true
+	} else if len(l.tokens) == 2 && strings.HasPrefix(l.tokens[1].text, "=") && !l.tokens[1].quoted && len(l.tokens[1].text) > 1 {
+		second := l.tokens[1]
+		return [2]token{first, {text: second.text[1:], pos: Pos{File: second.pos.File, Line: second.pos.Line, Col: second.pos.Col + 1}}}, true
+	}
+
+	return [2]token{}, false
+}
+
+func (p *parser) setting(key, value token, comment string) error {
+	name, ok := settingAliases[strings.ToLower(key.text)]
+	if !ok {
+		return p.f.Errorf(key.pos, "unknown setting '%s'", key.text)
+	}
+
+	switch name {
+	case "name":
+		p.f.Header.Name = value.text
+	case "version":
+		p.f.Header.Version = value.text
+	case "game":
+		p.f.Header.GameVersion = value.text
+	case "loader":
+		p.f.Header.Loader = strings.ToLower(value.text)
+	}
+
+	p.f.Nodes = append(p.f.Nodes, Setting{Pos: key.pos, Key: name, Value: value.text, Comment: comment})
+
+	return nil
+}
+
+func (p *parser) line(l line) error {
+	if l.empty() {
+		if l.hasComment {
+			p.f.Nodes = append(p.f.Nodes, Comment{Pos: l.commentPos, Text: l.comment})
+		} else {
+			p.f.Nodes = append(p.f.Nodes, Blank{Pos: Pos{File: p.f.Path, Line: l.num, Col: 1}})
+		}
+
+		return nil
+	}
+
+	if kv, ok := splitSetting(l); ok {
+		if p.f.Legacy {
+			return p.f.Errorf(kv[0].pos, "settings can't be used with the four line header")
+		} else if p.fragment {
+			return p.f.Errorf(kv[0].pos, "settings can only be used in the main Matrixfile")
+		} else if p.section != "" {
+			return p.f.Errorf(kv[0].pos, "settings can't be used in a profile")
+		}
+
+		return p.setting(kv[0], kv[1], l.comment)
+	}
+
+	tokens, conds, err := p.conditions(l.tokens)
+	if err != nil {
+		return err
+	}
+
+	head, args := tokens[0], tokens[1:]
+
+	arity := func(min, max int) error {
+		if len(args) < min {
+			return p.f.Errorf(head.pos, "'%s' expects at least %d arguments, but found %d", head.text, min, len(args))
+		} else if max >= 0 && len(args) > max && !p.f.Legacy {
+			return p.f.Errorf(args[max].pos, "'%s' expects at most %d arguments, but found %d", head.text, max, len(args))
+		}
+
+		return nil
+	}
+
+	keyword := head.text
+	if head.quoted {
+		keyword = ""
+	} else if strings.HasPrefix(keyword, "-") && len(keyword) > 1 {
+		keyword = "-"
+	}
+
+	if strings.HasPrefix(keyword, "[") {
+		return p.profile(l)
+	}
+
+	if len(conds) > 0 && slices.Contains([]string{"shaderloader", "datapacks", "compat", "overrides"}, keyword) {
+		return p.f.Errorf(conds[0].Pos, "'%s' can't have conditions", keyword)
+	}
+
+	switch keyword {
+	case "include":
+		if err := arity(1, 1); err != nil {
+			return err
+		}
+
+		p.f.Nodes = append(p.f.Nodes, Include{Pos: head.pos, Target: args[0].text, If: conds, Comment: l.comment})
+	case "-":
+		if len(args) > 0 {
+			return p.f.Errorf(args[0].pos, "excluding a mod doesn't take any flags")
+		}
+
+		p.f.Nodes = append(p.f.Nodes, Exclude{Pos: head.pos, Key: head.text[1:], If: conds, Comment: l.comment})
+	case "ext", "external":
+		if err := arity(2, 2); err != nil {
+			return err
+		}
+
+		p.f.Nodes = append(p.f.Nodes, External{Pos: head.pos, Name: args[0].text, Url: args[1].text, If: conds, Comment: l.comment})
+	case "shaderloader", "datapacks":
+		if err := arity(1, 1); err != nil {
+			return err
+		} else if p.fragment {
+			return p.f.Errorf(head.pos, "'%s' can only be used in the main Matrixfile", keyword)
+		} else if p.section != "" {
+			return p.f.Errorf(head.pos, "'%s' can't be used in a profile", keyword)
+		}
+
+		return p.setting(head, args[0], l.comment)
+	case "compat", "overrides":
+		if err := arity(1, -1); err != nil {
+			return err
+		} else if p.fragment {
+			return p.f.Errorf(head.pos, "'%s' can only be used in the main Matrixfile", keyword)
+		} else if p.section != "" {
+			return p.f.Errorf(head.pos, "'%s' can't be used in a profile", keyword)
+		}
+
+		d := Directive{Pos: head.pos, Name: keyword, Comment: l.comment}
+		for _, a := range args {
+			d.Args = append(d.Args, a.text)
+			d.ArgPos = append(d.ArgPos, a.pos)
+		}
+
+		p.f.Nodes = append(p.f.Nodes, d)
+	case "id":
+		if err := arity(1, -1); err != nil {
+			return err
+		}
+
+		return p.entry(Entry{Pos: head.pos, Id: args[0].text, If: conds, Comment: l.comment}, args[1:])
+	default:
+		return p.entry(Entry{Pos: head.pos, Slug: head.text, If: conds, Comment: l.comment}, args)
+	}
+
+	return nil
+}
+
+func (p *parser) addProfile(name string) {
+	if !slices.Contains(p.f.Profiles, name) {
+		p.f.Profiles = append(p.f.Profiles, name)
+	}
+}
+
+func (p *parser) profile(l line) error {
+	texts := []string{}
+	for _, t := range l.tokens {
+		texts = append(texts, t.text)
+	}
+
+	text := strings.Join(texts, " ")
+	fields := strings.Fields(strings.TrimSuffix(strings.TrimPrefix(text, "["), "]"))
+
+	if !strings.HasSuffix(text, "]") || len(fields) != 2 || fields[0] != "profile" {
+		return p.f.Errorf(l.tokens[0].pos, "expected '[profile <name>]'")
+	}
+
+	if fields[1] == "default" {
+		return p.f.Errorf(l.tokens[0].pos, "'default' is the name of the mods shared by every profile")
+	}
+
+	p.section = fields[1]
+	p.addProfile(fields[1])
+	p.f.Nodes = append(p.f.Nodes, Profile{Pos: l.tokens[0].pos, Name: fields[1], Comment: l.comment})
+
+	return nil
+}
+
+func (p *parser) entry(e Entry, flags []token) error {
+	if e.Slug == "|" {
+		return p.f.Errorf(e.Pos, "expected a mod before '|'")
+	}
+
+	// flags go to whichever mod they follow, tags are for the whole line
+	cur := &e
+
+	for i := 0; i < len(flags); i++ {
+		t := flags[i]
+
+		if t.text == "|" && !t.quoted {
+			if i+1 >= len(flags) || flags[i+1].text == "|" {
+				return p.f.Errorf(t.pos, "expected a mod after '|'")
+			}
+
+			i++
+			alt := Entry{Pos: flags[i].pos, Slug: flags[i].text}
+
+			if flags[i].text == "id" && !flags[i].quoted {
+				if i+1 >= len(flags) {
+					return p.f.Errorf(flags[i].pos, "'id' expects at least 1 arguments, but found 0")
+				}
+
+				i++
+				alt = Entry{Pos: flags[i-1].pos, Id: flags[i].text}
+			}
+
+			e.Alternatives = append(e.Alternatives, alt)
+			cur = &e.Alternatives[len(e.Alternatives)-1]
+
+			continue
+		}
+
+		if strings.HasPrefix(t.text, "@") && len(t.text) > 1 && !t.quoted {
+			e.Profiles = append(e.Profiles, t.text[1:])
+			p.addProfile(t.text[1:])
+			continue
+		}
+
+		k, v, ok := strings.Cut(t.text, ":")
+
+		// a value with spaces is quoted on its own, like `v:"1.0 beta"`
+		if ok && !t.quoted && v == "" && i+1 < len(flags) && flags[i+1].quoted && flags[i+1].pos.Line == t.pos.Line && flags[i+1].pos.Col == t.pos.Col+len([]rune(t.text)) {
+			i++
+			v = flags[i].text
+		}
+
+		if !ok || t.quoted {
+			// the original format silently ignored anything that wasn't a flag
+			if p.f.Legacy {
+				continue
+			}
+
+			return p.f.Errorf(t.pos, "expected a flag like 'v:<version id>', but found '%s'", t.text)
+		}
+
+		cur.Flags = append(cur.Flags, Flag{Pos: t.pos, Key: strings.TrimSpace(k), Value: strings.TrimSpace(v)})
+	}
+
+	p.f.Nodes = append(p.f.Nodes, e)
+
+	return nil
+}
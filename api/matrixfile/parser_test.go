@@ -0,0 +1,328 @@
+package matrixfile
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/voidwyrm-2/matrix/api/errs"
+)
+
+func TestParseLegacy(t *testing.T) {
+	f, err := Parse("Matrixfile", []byte(`Example Modpack
+1.0.0
+1.21.1
+NeoForge
+
+ext ftb-library.jar https://www.curseforge.com/minecraft/mc-mods/ftb-library-forge/download/6304123
+gamma-utils l:fabric
+id AANobbMI v:abc123 oops
+`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if f.Header != (Header{"Example Modpack", "1.0.0", "1.21.1", "neoforge"}) || !f.Legacy {
+		t.Fatalf("unexpected header %+v", f.Header)
+	}
+
+	entries := []Entry{}
+	for _, n := range f.Nodes {
+		if e, ok := n.(Entry); ok {
+			entries = append(entries, e)
+		}
+	}
+
+	if len(entries) != 2 || entries[0].Slug != "gamma-utils" || entries[1].Id != "AANobbMI" {
+		t.Fatalf("unexpected entries %+v", entries)
+	} else if v, _ := entries[1].Flag("v"); v.Value != "abc123" || v.Pos != (Pos{"Matrixfile", 8, 13}) {
+		t.Fatalf("unexpected flag %+v", v)
+	}
+}
+
+func TestParse(t *testing.T) {
+	f, err := Parse("Matrixfile", []byte(`# a comment
+name = "My Pack"
+version=1.0.0
+game = 1.21.1
+loader =fabric
+
+ext "My Mod.jar" "https://example.com/my mod.jar" # trailing
+	sodium	v:abc`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if f.Header != (Header{"My Pack", "1.0.0", "1.21.1", "fabric"}) || f.Legacy {
+		t.Fatalf("unexpected header %+v", f.Header)
+	}
+
+	ext, ok := f.Nodes[6].(External)
+	if !ok || ext.Name != "My Mod.jar" || ext.Url != "https://example.com/my mod.jar" || ext.Comment != "trailing" {
+		t.Fatalf("unexpected node %+v", f.Nodes[6])
+	}
+
+	if e, ok := f.Nodes[7].(Entry); !ok || e.Slug != "sodium" || e.Pos != (Pos{"Matrixfile", 8, 2}) {
+		t.Fatalf("unexpected node %+v", f.Nodes[7])
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := [][2]string{
+		{"name = a\nversion = 1\ngame = 1.21\nloader = fabric\nsodium 0.5", "Matrixfile:5:8: expected a flag like 'v:<version id>', but found '0.5'\n    sodium 0.5\n           ^"},
+		{"name = a\nversion = 1\n\tgame = \"1.21", "Matrixfile:3:9: unterminated string\n    \tgame = \"1.21\n    \t       ^"},
+		{"name = a\nversion = 1\ngame = 1.21", "Matrixfile:1:1: missing the 'loader' setting"},
+		{"a\nb\nc", "invalid Matrixfile format"},
+	}
+
+	for _, c := range cases {
+		_, err := Parse("Matrixfile", []byte(c[0]))
+		if err == nil {
+			t.Fatalf("expected `%s` to fail", c[0])
+		} else if !strings.Contains(err.Error(), c[1]) {
+			t.Fatalf("expected error `%s`, but got `%s` instead", c[1], err.Error())
+		}
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	files := map[string]string{
+		"base":  "sodium\nlithium\ninclude libs\next a.jar https://example.com/a.jar",
+		"libs":  "cloth-config\nsodium l:quilt",
+		"cycle": "include base\ninclude cycle",
+	}
+
+	read := func(from, target string) (string, []byte, error) {
+		return target, []byte(files[target]), nil
+	}
+
+	f, err := Parse("Matrixfile", []byte("name = a\nversion = 1\ngame = 1.21\nloader = fabric\ninclude base\n-lithium\n-a.jar\njade\ncloth-config v:abc"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	flat, chain, err := f.Flatten(read, Target{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	entries := []string{}
+	for _, n := range flat.Nodes {
+		if e, ok := n.(Entry); ok {
+			entries = append(entries, e.Slug+"@"+e.Pos.File)
+		} else if _, ok := n.(External); ok {
+			t.Fatalf("expected a.jar to be excluded")
+		}
+	}
+
+	if result := strings.Join(entries, " "); result != "sodium@libs cloth-config@Matrixfile jade@Matrixfile" {
+		t.Fatalf("unexpected entries `%s`", result)
+	} else if strings.Join(chain, " ") != "base libs" {
+		t.Fatalf("unexpected include chain %v", chain)
+	}
+
+	f, _ = Parse("Matrixfile", []byte("name = a\nversion = 1\ngame = 1.21\nloader = fabric\ninclude cycle"))
+	if _, _, err = f.Flatten(read, Target{}); err == nil || !strings.Contains(err.Error(), "include cycle: cycle -> cycle") {
+		t.Fatalf("expected an include cycle, but got `%v`", err)
+	}
+
+	// an include that can't be read fails with why, rather than as a parse error
+	missing := func(from, target string) (string, []byte, error) {
+		return "", nil, &fs.PathError{Op: "open", Path: target, Err: fs.ErrNotExist}
+	}
+
+	f, _ = Parse("Matrixfile", []byte("name = a\nversion = 1\ngame = 1.21\nloader = fabric\ninclude gone"))
+	if _, _, err = f.Flatten(missing, Target{}); !errors.Is(err, fs.ErrNotExist) || errors.Is(err, errs.ErrParse) {
+		t.Fatalf("expected the include to be missing rather than a parse error, but got `%v`", err)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	f, err := Parse("Matrixfile", []byte("name = a\nversion = 1\ngame = 1.21\nloader = fabric\nsodium\njade\nminimap @full @lite\n[profile lite]\n-jade\nembeddium\n[profile full]\n"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	cases := map[string]string{
+		"":     "sodium jade",
+		"lite": "sodium minimap embeddium",
+		"full": "sodium jade minimap",
+	}
+
+	for profile, expect := range cases {
+		flat, _, err := f.Flatten(nil, Target{Profile: profile})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		entries := []string{}
+		for _, n := range flat.Nodes {
+			if e, ok := n.(Entry); ok {
+				entries = append(entries, e.Slug)
+			}
+		}
+
+		if result := strings.Join(entries, " "); result != expect {
+			t.Fatalf("expected profile '%s' to have `%s`, but got `%s` instead", profile, expect, result)
+		}
+	}
+
+	if _, _, err = f.Flatten(nil, Target{Profile: "server"}); err == nil {
+		t.Fatalf("expected an unknown profile to fail")
+	}
+}
+
+func TestConditions(t *testing.T) {
+	f, err := Parse("Matrixfile", []byte("name = a\nversion = 1\ngame = 1.21.1\nloader = fabric\nsodium if loader=fabric,quilt\nembeddium if loader!=fabric,quilt\nold-mod if game<1.21\nnew-mod v:abc if game>=1.21 loader=fabric\nexact if minecraft=1.21.1\n"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	cases := map[Target]string{
+		{}:                                       "sodium new-mod exact",
+		{Loader: "neoforge"}:                     "embeddium exact",
+		{Loader: "quilt", GameVersion: "1.20.1"}: "sodium old-mod",
+		{GameVersion: "1.21"}:                    "sodium new-mod",
+	}
+
+	for target, expect := range cases {
+		flat, _, err := f.Flatten(nil, target)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		entries := []string{}
+		for _, n := range flat.Nodes {
+			if e, ok := n.(Entry); ok {
+				entries = append(entries, e.Slug)
+			}
+		}
+
+		if result := strings.Join(entries, " "); result != expect {
+			t.Fatalf("expected %+v to have `%s`, but got `%s` instead", target, expect, result)
+		}
+	}
+
+	errs := [][2]string{
+		{"sodium if", "expected conditions after 'if'"},
+		{"sodium if loader>fabric", "loaders can only be compared with '=' or '!='"},
+		{"sodium if side=client", "unknown condition 'side'"},
+		{"sodium if game>=1.20,1.21", "only '=' and '!=' can be given more than one version"},
+		{"compat accept quilt fabric if loader=quilt", "'compat' can't have conditions"},
+	}
+
+	for _, c := range errs {
+		_, err := Parse("Matrixfile", []byte("name = a\nversion = 1\ngame = 1.21\nloader = fabric\n"+c[0]))
+		if err == nil || !strings.Contains(err.Error(), c[1]) {
+			t.Fatalf("expected error `%s`, but got `%v` instead", c[1], err)
+		}
+	}
+}
+
+func TestAlternatives(t *testing.T) {
+	f, err := Parse("Matrixfile", []byte("name = a\nversion = 1\ngame = 1.21\nloader = fabric\nsodium v:abc | embeddium l:neoforge|id Zx3k @lite\n"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	e := f.Nodes[4].(Entry)
+	if e.Slug != "sodium" || len(e.Flags) != 1 || len(e.Alternatives) != 2 || len(e.Profiles) != 1 {
+		t.Fatalf("unexpected entry %+v", e)
+	} else if a := e.Alternatives[0]; a.Slug != "embeddium" || len(a.Flags) != 1 || a.Flags[0].Value != "neoforge" {
+		t.Fatalf("unexpected alternative %+v", a)
+	} else if a := e.Alternatives[1]; a.Id != "Zx3k" || a.Pos != (Pos{"Matrixfile", 5, 37}) {
+		t.Fatalf("unexpected alternative %+v", a)
+	}
+
+	for _, c := range []string{"sodium |", "| sodium", "sodium | | embeddium"} {
+		if _, err := Parse("Matrixfile", []byte("name = a\nversion = 1\ngame = 1.21\nloader = fabric\n"+c)); err == nil {
+			t.Fatalf("expected `%s` to fail", c)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	src := `# My pack
+
+Example Pack
+1.0.0
+1.21.1
+Fabric
+ext b.jar https://example.com/b.jar
+# performance
+sodium   l:fabric v:abc
+  lithium
+compat accept quilt fabric
+
+
+include "shared mods.txt"
+-jade
+zoomify|id abc @lite if game>=1.21
+
+# for the lite version
+[profile lite]
+embeddium # why not
+`
+
+	expect := `# My pack
+
+name = "Example Pack"
+version = 1.0.0
+game = 1.21.1
+loader = fabric
+
+compat accept quilt fabric
+
+# performance
+sodium v:abc l:fabric
+lithium
+
+include "shared mods.txt"
+-jade
+zoomify | id abc @lite if game>=1.21
+
+ext b.jar https://example.com/b.jar
+
+# for the lite version
+[profile lite]
+embeddium # why not
+`
+
+	f, err := Parse("Matrixfile", []byte(src))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if result := string(f.Format(false)); result != expect {
+		t.Fatalf("unexpected result:\n%s", result)
+	}
+
+	f, err = Parse("Matrixfile", []byte(expect))
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if result := string(f.Format(false)); result != expect {
+		t.Fatalf("formatting again changed it to:\n%s", result)
+	}
+
+	if result := string(f.Format(true)); !strings.Contains(result, "lithium\n# performance\nsodium") {
+		t.Fatalf("expected the mods to be sorted, but got:\n%s", result)
+	}
+}
+
+func TestIsUrl(t *testing.T) {
+	cases := map[string]bool{
+		"https://example.com/mods.matrix": true,
+		"http://example.com/mods.matrix":  true,
+		"http-mods.matrix":                false,
+		"https/mods.matrix":               false,
+		"ftp://example.com/mods.matrix":   false,
+		"https://":                        false,
+	}
+
+	for s, expect := range cases {
+		if IsUrl(s) != expect {
+			t.Fatalf("expected IsUrl(%s) to be %t", s, expect)
+		}
+	}
+}
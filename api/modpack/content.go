@@ -0,0 +1,74 @@
+package modpack
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/voidwyrm-2/matrix/api/remotemod"
+)
+
+const (
+	TypeMod          = "mod"
+	TypeResourcePack = "resourcepack"
+	TypeShader       = "shader"
+	TypeDatapack     = "datapack"
+)
+
+var contentTypes = []string{TypeMod, TypeResourcePack, TypeShader, TypeDatapack}
+
+func checkType(kind string) error {
+	if !slices.Contains(contentTypes, kind) {
+		return fmt.Errorf("unknown type '%s', expected one of %v", kind, contentTypes)
+	}
+
+	return nil
+}
+
+// the folder, relative to the instance, that content of the given type is downloaded into
+func (mp Modpack) dir(kind string) string {
+	switch kind {
+	case TypeResourcePack:
+		return "resourcepacks"
+	case TypeShader:
+		return "shaderpacks"
+	case TypeDatapack:
+		return mp.datapackDir
+	default:
+		return "mods"
+	}
+}
+
+// the loader versions of a project have to support for it to be used as the given type
+func (mp Modpack) loaderFor(kind string) string {
+	switch kind {
+	case TypeResourcePack:
+		return "minecraft"
+	case TypeShader:
+		return mp.shaderLoader
+	case TypeDatapack:
+		return "datapack"
+	default:
+		return ""
+	}
+}
+
+// decides what a picked version is, going by the project type and the loaders the version supports
+func (mp Modpack) detectType(remote remotemod.RemoteMod, v remotemod.RemoteModVersion, loader, forced string) string {
+	if forced != "" {
+		return forced
+	}
+
+	switch remote.ProjectType {
+	case "resourcepack":
+		return TypeResourcePack
+	case "shader":
+		return TypeShader
+	}
+
+	modloaders := mp.compat.Loaders(loader, mp.gameVersion.String())
+	if slices.Contains(v.Loaders, "datapack") && !slices.ContainsFunc(v.Loaders, func(l string) bool { return slices.Contains(modloaders, l) }) {
+		return TypeDatapack
+	}
+
+	return TypeMod
+}
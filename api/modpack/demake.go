@@ -0,0 +1,176 @@
+package modpack
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/voidwyrm-2/matrix/api/internal"
+	"github.com/voidwyrm-2/matrix/api/matrixfile"
+)
+
+// the key a mod is listed under in the Matrixfile, which is how it's excluded
+func matrixfileKey(m internal.PublicLocalMod) string {
+	if m.ById || m.Slug == "" {
+		return m.Id
+	}
+
+	return m.Slug
+}
+
+func toEntry(m internal.PublicLocalMod) matrixfile.Entry {
+	e := matrixfile.Entry{Slug: m.Slug}
+	if m.ById || m.Slug == "" {
+		e = matrixfile.Entry{Id: m.Id}
+	}
+
+	for _, flag := range [][2]string{{"v", m.ForceVersion}, {"l", m.ForceLoader}, {"t", m.ForceType}} {
+		if flag[1] != "" {
+			e.Flags = append(e.Flags, matrixfile.Flag{Key: flag[0], Value: flag[1]})
+		}
+	}
+
+	for _, a := range m.Alternatives {
+		e.Alternatives = append(e.Alternatives, toEntry(a))
+	}
+
+	return e
+}
+
+// generates a Matrixfile that makes the same matrix.toml, leaving out dependencies and whatever comes from an include
+func (mp Modpack) ToMatrixfile() *matrixfile.File {
+	f := &matrixfile.File{Path: "Matrixfile", Header: matrixfile.Header{Name: mp.name, Version: mp.version.String(), GameVersion: mp.gameVersion.String(), Loader: mp.modloader}}
+
+	shared := []matrixfile.Node{}
+	sections := map[string][]matrixfile.Node{}
+
+	for _, s := range [][2]string{{"name", f.Header.Name}, {"version", f.Header.Version}, {"game", f.Header.GameVersion}, {"loader", f.Header.Loader}} {
+		shared = append(shared, matrixfile.Setting{Key: s[0], Value: s[1]})
+	}
+
+	if mp.shaderLoader != "iris" {
+		shared = append(shared, matrixfile.Setting{Key: "shaderloader", Value: mp.shaderLoader})
+	}
+
+	if mp.datapackDir != "datapacks" {
+		shared = append(shared, matrixfile.Setting{Key: "datapacks", Value: mp.datapackDir})
+	}
+
+	for _, rule := range mp.compatRules {
+		shared = append(shared, matrixfile.Directive{Name: "compat", Args: strings.Fields(rule)})
+	}
+
+	for _, o := range []struct {
+		side, dir, fallback string
+	}{
+		{"", mp.overrides.Common, defaultOverrides.Common},
+		{SideClient, mp.overrides.Client, defaultOverrides.Client},
+		{SideServer, mp.overrides.Server, defaultOverrides.Server},
+	} {
+		if o.dir != "" && o.dir != o.fallback {
+			d := matrixfile.Directive{Name: "overrides", Args: []string{o.dir}}
+			if o.side != "" {
+				d.Args = []string{o.side, o.dir}
+			}
+
+			shared = append(shared, d)
+		}
+	}
+
+	for _, include := range mp.includes {
+		shared = append(shared, matrixfile.Include{Target: include})
+	}
+
+	for _, exclude := range mp.excludes {
+		shared = append(shared, matrixfile.Exclude{Key: exclude})
+	}
+
+	profiles := []string{}
+	for _, p := range mp.profiles {
+		if p != DefaultProfile {
+			profiles = append(profiles, p)
+		}
+	}
+
+	for _, p := range profiles {
+		for _, include := range mp.profileIncludes[p] {
+			sections[p] = append(sections[p], matrixfile.Include{Target: include})
+		}
+	}
+
+	// content in the shared section is excluded from the profiles it isn't in, and content in only some profiles goes in their sections
+	place := func(node matrixfile.Node, key string, in []string, included bool) []string {
+		if len(in) == 0 || slices.Contains(in, DefaultProfile) {
+			for _, p := range profiles {
+				if len(in) > 0 && !slices.Contains(in, p) {
+					sections[p] = append(sections[p], matrixfile.Exclude{Key: key})
+				}
+			}
+
+			if !included {
+				shared = append(shared, node)
+			}
+
+			return nil
+		}
+
+		return in
+	}
+
+	// the profiles whose includes have already added a mod, since a mod after one of those has to be in the section to keep its place
+	profileIncluded := map[string]bool{}
+
+	for _, m := range mp.mods.mdrth {
+		p := m.ToPublic()
+		if p.Dependency {
+			continue
+		}
+
+		for profile, includes := range mp.profileIncludes {
+			if p.From != "" && slices.ContainsFunc(includes, func(include string) bool { return filepath.Clean(include) == p.From }) {
+				profileIncluded[profile] = true
+			}
+		}
+
+		e := toEntry(p)
+		in := place(e, matrixfileKey(p), p.Profiles, p.From != "")
+
+		switch {
+		case len(in) == 0 || p.From != "":
+			// included mods come back with the include
+		case len(in) == 1 && profileIncluded[in[0]]:
+			sections[in[0]] = append(sections[in[0]], e)
+		default:
+			e.Profiles = in
+			shared = append(shared, e)
+		}
+	}
+
+	names := []string{}
+	for name := range mp.mods.external {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	for _, name := range names {
+		ext := matrixfile.External{Name: name, Url: mp.mods.external[name]}
+
+		for _, p := range place(ext, name, mp.externalProfiles[name], mp.externalFrom[name] != "") {
+			if mp.externalFrom[name] == "" {
+				sections[p] = append(sections[p], ext)
+			}
+		}
+	}
+
+	f.Nodes = shared
+
+	for _, p := range profiles {
+		f.Nodes = append(f.Nodes, matrixfile.Profile{Name: p})
+		f.Nodes = append(f.Nodes, sections[p]...)
+	}
+
+	f.Profiles = profiles
+
+	return f
+}
@@ -0,0 +1,146 @@
+package modpack
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/voidwyrm-2/matrix/api/logging"
+)
+
+// the kind of download for external mods
+const KindExternal = "external mod"
+
+// something that happened while syncing, one of the types below
+type Event interface {
+	event()
+}
+
+// gets told about everything that happens while syncing, e.g. to show progress in a launcher.
+// Downloads happen at the same time, so Notify has to be safe to call from more than one goroutine
+type Observer interface {
+	Notify(e Event)
+}
+
+type ResolveStarted struct {
+	Mods int
+}
+
+type Resolved struct {
+	// how many mods and dependencies were picked
+	Picks int
+}
+
+type VersionChosen struct {
+	Mod, Version, Loader string
+}
+
+// something the user should know about a mod, like it being forced to a version
+type Notice struct {
+	Mod, Message string
+}
+
+type DownloadStarted struct {
+	// what's being downloaded, e.g. "mod", "dependency" or "external mod"
+	Kind, Mod, Version, Url string
+}
+
+type DownloadProgress struct {
+	Kind, Mod string
+	// Total is -1 if the server didn't say how big the file is
+	Bytes, Total int64
+}
+
+type Downloaded struct {
+	Kind, Mod, Version, File string
+}
+
+type Skipped struct {
+	Mod, Reason string
+}
+
+// a download that failed, Skipped if the sync carries on without it, like an external mod the site doesn't allow downloading
+type Failed struct {
+	Kind, Mod, Url string
+	Err            error
+	Skipped        bool
+}
+
+type OverrideStarted struct {
+	File string
+}
+
+type OverridesCopied struct {
+	Count int
+}
+
+// the sync is finished
+type Done struct {
+	Mods int
+}
+
+func (ResolveStarted) event()   {}
+func (Resolved) event()         {}
+func (VersionChosen) event()    {}
+func (Notice) event()           {}
+func (DownloadStarted) event()  {}
+func (DownloadProgress) event() {}
+func (Downloaded) event()       {}
+func (Skipped) event()          {}
+func (Failed) event()           {}
+func (OverrideStarted) event()  {}
+func (OverridesCopied) event()  {}
+func (Done) event()             {}
+
+// logs every event, which is what's used if no observer is set
+type LogObserver struct{}
+
+func (LogObserver) Notify(e Event) {
+	switch e := e.(type) {
+	case ResolveStarted:
+		logging.Progress(fmt.Sprintf("resolving %d mods...", e.Mods), "mods", e.Mods)
+	case Resolved:
+		slog.Info(fmt.Sprintf("resolved %d mods and dependencies", e.Picks), "mods", e.Picks)
+	case VersionChosen:
+		slog.Debug(fmt.Sprintf("picked '%s' %s for %s", e.Mod, e.Version, e.Loader), "mod", e.Mod, "version", e.Version, "loader", e.Loader)
+	case Notice:
+		logging.Note(e.Message, "mod", e.Mod)
+	case DownloadStarted:
+		msg := fmt.Sprintf("downloading %s '%s'...", e.Kind, e.Mod)
+		if e.Version != "" {
+			msg = fmt.Sprintf("downloading %s '%s' %s...", e.Kind, e.Mod, e.Version)
+		}
+
+		logging.Progress(msg, "kind", e.Kind, "mod", e.Mod, "version", e.Version, "url", e.Url)
+	case Downloaded:
+		slog.Info(fmt.Sprintf("downloaded %s '%s'", e.Kind, e.File), "kind", e.Kind, "mod", e.Mod, "version", e.Version, "file", e.File)
+	case Skipped:
+		logging.Note(fmt.Sprintf("skipped '%s' because %s", e.Mod, e.Reason), "mod", e.Mod)
+	case Failed:
+		msg := fmt.Sprintf("couldn't download %s '%s': %s", e.Kind, e.Mod, strings.TrimSpace(e.Err.Error()))
+		if e.Skipped {
+			msg = fmt.Sprintf("%s could not be downloaded, please remove or download manually: '%s' at '%s'", e.Kind, e.Mod, e.Url)
+		}
+
+		slog.Warn(msg, "kind", e.Kind, "mod", e.Mod, "url", e.Url, "error", e.Err.Error())
+	case OverrideStarted:
+		logging.Progress(fmt.Sprintf("copying override '%s'...", e.File), "file", e.File)
+	case OverridesCopied:
+		slog.Info(fmt.Sprintf("copied %d overrides", e.Count), "overrides", e.Count)
+	case Done:
+		slog.Info(fmt.Sprintf("synced %d mods", e.Mods), "mods", e.Mods)
+	}
+}
+
+// sets what's told about everything that happens while syncing, instead of it being logged
+func (mp *Modpack) SetObserver(o Observer) {
+	mp.observer = o
+}
+
+func (mp Modpack) notify(e Event) {
+	if mp.observer == nil {
+		LogObserver{}.Notify(e)
+	} else {
+		mp.observer.Notify(e)
+	}
+}
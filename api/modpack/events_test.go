@@ -0,0 +1,45 @@
+package modpack
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/voidwyrm-2/matrix/api/internal"
+)
+
+type recorder struct {
+	events []Event
+}
+
+func (r *recorder) Notify(e Event) {
+	r.events = append(r.events, e)
+}
+
+func TestOverrideEvents(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "overrides", "config"), os.ModePerm)
+	os.WriteFile(filepath.Join(dir, "overrides", "config", "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(dir, "overrides", "b.txt"), []byte("b"), 0644)
+
+	r := &recorder{}
+	mp := Modpack{overrides: internal.PublicOverrides{Common: filepath.Join(dir, "overrides")}}
+	mp.SetObserver(r)
+	mp.SetInstanceDir(filepath.Join(dir, "instance"))
+
+	if err := mp.ApplyOverrides(context.Background(), SideClient, false); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expect := []Event{
+		OverrideStarted{File: filepath.ToSlash(filepath.Join(dir, "instance", "b.txt"))},
+		OverrideStarted{File: filepath.ToSlash(filepath.Join(dir, "instance", "config", "a.txt"))},
+		OverridesCopied{Count: 2},
+	}
+
+	if !reflect.DeepEqual(r.events, expect) {
+		t.Fatalf("expected %v, but got %v", expect, r.events)
+	}
+}
@@ -0,0 +1,201 @@
+package modpack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/voidwyrm-2/matrix/api/errs"
+	"github.com/voidwyrm-2/matrix/api/internal"
+)
+
+// plans installing exactly the files recorded in the matrix.toml, without looking anything up on Modrinth;
+// every mod has to have been synced, so its version, file and hash are known
+func (mp *Modpack) FrozenPlan() (Plan, error) {
+	plan := Plan{Pack: mp.source, Profile: mp.profile}
+	unlocked := []string{}
+
+	for _, m := range mp.mods.mdrth {
+		plan.Mods = append(plan.Mods, m.ToPublic())
+
+		if !m.InProfile(mp.profile) {
+			continue
+		}
+
+		a := m.Active()
+		_, url, sha1 := a.Locked()
+
+		if url == "" || sha1 == "" || a.File() == "" {
+			unlocked = append(unlocked, a.GetIdOrSlug())
+			continue
+		}
+
+		kind := a.Type()
+		if m.IsDependency() {
+			kind = "dependency"
+		}
+
+		mp.planFile(&plan, Change{Action: ActionInstall, Kind: kind, Mod: a.GetIdOrSlug(), To: a.Version().String(), Url: url, File: a.File(), Sha1: sha1})
+	}
+
+	if !mp.ignoreExternals {
+		for _, name := range sortedKeys(mp.mods.external) {
+			if profiles, ok := mp.externalProfiles[name]; ok && !slices.Contains(profiles, mp.profile) {
+				continue
+			}
+
+			sha1, ok := mp.externalHashes[name]
+			if !ok {
+				unlocked = append(unlocked, name)
+				continue
+			} else if sha1 == "" {
+				mp.notify(Skipped{Mod: name, Reason: "it couldn't be downloaded when it was synced, so it has to be downloaded manually"})
+				continue
+			}
+
+			mp.planFile(&plan, Change{Action: ActionInstall, Kind: KindExternal, Mod: name, Url: mp.mods.external[name], File: path.Join("mods", name), Sha1: sha1})
+		}
+	}
+
+	if len(unlocked) > 0 {
+		return Plan{}, errs.Errorf(errs.ErrNotFound, "these mods haven't been synced, so there's nothing to install them from, run 'matrix sync' first:\n  %s", strings.Join(unlocked, "\n  "))
+	}
+
+	return plan, nil
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
+// adds a file to the plan, unless it's already there with the right hash
+func (mp Modpack) planFile(plan *Plan, c Change) {
+	if content, err := os.ReadFile(mp.instancePath(filepath.FromSlash(c.File))); err == nil {
+		if internal.Sha1(content) == c.Sha1 {
+			plan.Unchanged++
+			return
+		}
+
+		c.Action = ActionReinstall
+	}
+
+	plan.Changes = append(plan.Changes, c)
+}
+
+// the parts of a mod that come from the Matrixfile, leaving out what syncing it fills in
+func declared(m internal.PublicLocalMod) string {
+	key := m.Slug
+	if m.ById {
+		key = m.Id
+	}
+
+	alternatives := []string{}
+	for _, a := range m.Alternatives {
+		alternatives = append(alternatives, declared(a))
+	}
+
+	s := key
+	for _, f := range []struct{ flag, value string }{{"v", m.ForceVersion}, {"l", m.ForceLoader}, {"t", m.ForceType}} {
+		if f.value != "" {
+			s += fmt.Sprintf(" -%s %s", f.flag, f.value)
+		}
+	}
+
+	if len(alternatives) > 0 {
+		s += " | " + strings.Join(alternatives, " | ")
+	}
+
+	if m.From != "" {
+		s += " (from " + m.From + ")"
+	}
+
+	if len(m.Profiles) > 0 {
+		s += " [" + strings.Join(m.Profiles, ", ") + "]"
+	}
+
+	return s
+}
+
+// checks that the Matrixfile still makes the pack, apart from what syncing it filled in
+func (mp Modpack) CheckMatrixfile(ctx context.Context, source string) error {
+	want, err := fromMatrixfile(ctx, mp.packDir, source, mp.defaultProfile, mp.modloader, mp.gameVersion.String())
+	if err != nil {
+		return err
+	}
+
+	// the defaults FromToml fills in
+	if want.ShaderLoader == "" {
+		want.ShaderLoader = "iris"
+	}
+
+	if want.DatapackDir == "" {
+		want.DatapackDir = "datapacks"
+	}
+
+	problems := []string{}
+
+	for _, f := range []struct{ name, matrixfile, toml string }{
+		{"the name", want.Name, mp.name},
+		{"the version", want.ModpackVersion, mp.version.String()},
+		{"the shader loader", want.ShaderLoader, mp.shaderLoader},
+		{"the data pack folder", want.DatapackDir, mp.datapackDir},
+		{"the compat rules", fmt.Sprint(want.Compat), fmt.Sprint(mp.compatRules)},
+		{"the profiles", fmt.Sprint(want.Profiles), fmt.Sprint(mp.profiles)},
+		{"the common overrides", want.Overrides.Common, mp.overrides.Common},
+		{"the client overrides", want.Overrides.Client, mp.overrides.Client},
+		{"the server overrides", want.Overrides.Server, mp.overrides.Server},
+	} {
+		if f.matrixfile != f.toml {
+			problems = append(problems, fmt.Sprintf("%s is '%s' in the Matrixfile but '%s' in the matrix.toml", f.name, f.matrixfile, f.toml))
+		}
+	}
+
+	wanted, have := map[string]struct{}{}, map[string]struct{}{}
+
+	for _, m := range want.Mods.Mdrth {
+		wanted[declared(m)] = struct{}{}
+	}
+
+	for name, url := range want.Mods.External {
+		wanted[fmt.Sprintf("%s %s %v", name, url, want.ExternalProfiles[name])] = struct{}{}
+	}
+
+	for _, m := range mp.mods.mdrth {
+		if !m.IsDependency() {
+			have[declared(m.ToPublic())] = struct{}{}
+		}
+	}
+
+	for name, url := range mp.mods.external {
+		have[fmt.Sprintf("%s %s %v", name, url, mp.externalProfiles[name])] = struct{}{}
+	}
+
+	for _, m := range sortedKeys(wanted) {
+		if _, ok := have[m]; !ok {
+			problems = append(problems, fmt.Sprintf("'%s' is in the Matrixfile but not the matrix.toml", m))
+		}
+	}
+
+	for _, m := range sortedKeys(have) {
+		if _, ok := wanted[m]; !ok {
+			problems = append(problems, fmt.Sprintf("'%s' is in the matrix.toml but not the Matrixfile", m))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errs.Errorf(errs.ErrIncompatible, "the Matrixfile and matrix.toml disagree, run 'matrix make' and 'matrix sync' to update it:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
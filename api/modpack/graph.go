@@ -0,0 +1,169 @@
+package modpack
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/voidwyrm-2/matrix/api/errs"
+	"github.com/voidwyrm-2/matrix/api/localmod"
+)
+
+func (mp Modpack) lookup() map[string]localmod.LocalMod {
+	m := map[string]localmod.LocalMod{}
+
+	for _, lm := range mp.mods.mdrth {
+		p, a := lm.ToPublic(), lm.Active().ToPublic()
+		m[p.Id], m[p.Slug], m[a.Id], m[a.Slug] = lm, lm, lm, lm
+	}
+
+	delete(m, "")
+
+	return m
+}
+
+// the mods listed in the Matrixfile, which every dependency path starts from
+func (mp Modpack) Roots() []localmod.LocalMod {
+	roots := []localmod.LocalMod{}
+
+	for _, lm := range mp.mods.mdrth {
+		if !lm.IsDependency() {
+			roots = append(roots, lm)
+		}
+	}
+
+	return roots
+}
+
+func (mp Modpack) WriteTree(w io.Writer) error {
+	mods := mp.lookup()
+	expanded := map[string]struct{}{}
+
+	var walk func(lm localmod.LocalMod, prefix string, last, root bool) error
+	walk = func(lm localmod.LocalMod, prefix string, last, root bool) error {
+		line, childPrefix := "", ""
+		if !root {
+			line, childPrefix = prefix+"├── ", prefix+"│   "
+			if last {
+				line, childPrefix = prefix+"└── ", prefix+"    "
+			}
+		}
+
+		line += describe(lm)
+
+		_, seen := expanded[lm.GetIdOrSlug()]
+		if seen && len(lm.Requires()) > 0 {
+			line += " (*)"
+		}
+
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		} else if seen {
+			return nil
+		}
+
+		expanded[lm.GetIdOrSlug()] = struct{}{}
+
+		for i, slug := range lm.Requires() {
+			dep, ok := mods[slug]
+			if !ok {
+				dep = localmod.NewWithoutVersion("", "", "", slug, "", "")
+			}
+
+			if err := walk(dep, childPrefix, i == len(lm.Requires())-1, false); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, lm := range mp.Roots() {
+		if err := walk(lm, "", false, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (mp Modpack) WriteDot(w io.Writer) error {
+	b := strings.Builder{}
+	b.WriteString(fmt.Sprintf("digraph %q {\n", mp.name))
+
+	for _, lm := range mp.mods.mdrth {
+		shape := "ellipse"
+		if !lm.IsDependency() {
+			shape = "box"
+		}
+
+		b.WriteString(fmt.Sprintf("\t%q [label=%q, shape=%s];\n", lm.GetIdOrSlug(), describe(lm), shape))
+	}
+
+	for _, lm := range mp.mods.mdrth {
+		for _, slug := range lm.Requires() {
+			b.WriteString(fmt.Sprintf("\t%q -> %q;\n", lm.GetIdOrSlug(), slug))
+		}
+	}
+
+	b.WriteString("}\n")
+
+	_, err := w.Write([]byte(b.String()))
+	return err
+}
+
+// returns every path from a mod in the Matrixfile to the given mod
+func (mp Modpack) Why(idOrSlug string) ([][]localmod.LocalMod, error) {
+	mods := mp.lookup()
+
+	target, ok := mods[idOrSlug]
+	if !ok {
+		return nil, errs.Errorf(errs.ErrNotFound, "mod '%s' is not in the modpack", idOrSlug)
+	}
+
+	paths := [][]localmod.LocalMod{}
+
+	var walk func(path []localmod.LocalMod)
+	walk = func(path []localmod.LocalMod) {
+		cur := path[len(path)-1]
+		if cur.GetIdOrSlug() == target.GetIdOrSlug() {
+			paths = append(paths, append([]localmod.LocalMod{}, path...))
+			return
+		}
+
+		for _, slug := range cur.Requires() {
+			dep, ok := mods[slug]
+			if !ok {
+				continue
+			}
+
+			cycle := false
+			for _, p := range path {
+				cycle = cycle || p.GetIdOrSlug() == dep.GetIdOrSlug()
+			}
+
+			if !cycle {
+				walk(append(path, dep))
+			}
+		}
+	}
+
+	for _, root := range mp.Roots() {
+		walk([]localmod.LocalMod{root})
+	}
+
+	return paths, nil
+}
+
+func describe(lm localmod.LocalMod) string {
+	name := lm.Active().GetIdOrSlug()
+	if v := lm.Active().ToPublic().Version; v != "" {
+		name += " " + v
+	}
+
+	if lm.Chosen() != "" {
+		name += " (instead of " + lm.GetIdOrSlug() + ")"
+	}
+
+	return name
+}
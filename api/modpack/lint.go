@@ -0,0 +1,285 @@
+package modpack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/voidwyrm-2/matrix/api/compat"
+	"github.com/voidwyrm-2/matrix/api/errs"
+	"github.com/voidwyrm-2/matrix/api/matrixfile"
+	"github.com/voidwyrm-2/matrix/api/remotemod"
+)
+
+// the loaders Modrinth knows about, including the ones for shaders, resource packs and data packs
+var knownLoaders = []string{
+	"babric", "bta-babric", "bukkit", "bungeecord", "canvas", "datapack", "fabric", "folia", "forge", "iris", "java-agent",
+	"legacy-fabric", "liteloader", "minecraft", "modloader", "neoforge", "nilloader", "optifine", "ornithe", "paper",
+	"purpur", "quilt", "rift", "spigot", "sponge", "vanilla", "velocity", "waterfall",
+}
+
+var knownFlags = []string{"v", "l", "t"}
+
+type linter struct {
+	ctx      context.Context
+	online   bool
+	problems []error
+	// the files that have been checked, so includes used more than once are only checked once
+	checked map[string]struct{}
+}
+
+func (l *linter) report(f *matrixfile.File, pos matrixfile.Pos, format string, a ...any) {
+	l.problems = append(l.problems, f.Errorf(pos, format, a...))
+}
+
+func (l *linter) loader(f *matrixfile.File, pos matrixfile.Pos, loader string) {
+	if !slices.Contains(knownLoaders, strings.ToLower(loader)) {
+		l.report(f, pos, "unknown loader '%s'", loader)
+	}
+}
+
+func (l *linter) entry(f *matrixfile.File, e matrixfile.Entry) {
+	for _, flag := range e.Flags {
+		switch {
+		case !slices.Contains(knownFlags, flag.Key):
+			l.report(f, flag.Pos, "unknown flag '%s', expected one of %v", flag.Key, knownFlags)
+		case flag.Value == "":
+			l.report(f, flag.Pos, "flag '%s' is missing a value", flag.Key)
+		case flag.Key == "l":
+			l.loader(f, flag.Pos, flag.Value)
+		case flag.Key == "t":
+			if err := checkType(flag.Value); err != nil {
+				l.report(f, flag.Pos, "%s", err.Error())
+			}
+		}
+	}
+
+	for _, a := range e.Alternatives {
+		l.entry(f, a)
+	}
+}
+
+// checks a single file and whatever it includes
+func (l *linter) file(f *matrixfile.File) {
+	l.checked[f.Path] = struct{}{}
+
+	// mods listed twice in the same section are probably a mistake, since the second replaces the first
+	seen := map[string]matrixfile.Pos{}
+	section := ""
+
+	// the same mod with different conditions is fine
+	duplicate := func(n matrixfile.Node, key, name string) {
+		pos := n.Position()
+		key = section + "\x00" + strings.ToLower(key) + "\x00" + fmt.Sprint(matrixfile.Conditions(n))
+
+		if first, ok := seen[key]; ok {
+			l.report(f, pos, "%s is already listed on line %d", name, first.Line)
+		} else {
+			seen[key] = pos
+		}
+	}
+
+	for _, n := range f.Nodes {
+		for _, c := range matrixfile.Conditions(n) {
+			if c.Key == "loader" {
+				for _, v := range c.Values {
+					l.loader(f, c.Pos, v)
+				}
+			}
+		}
+
+		switch n := n.(type) {
+		case matrixfile.Profile:
+			section = n.Name
+		case matrixfile.Setting:
+			if n.Key == "loader" || n.Key == "shaderloader" {
+				l.loader(f, n.Pos, n.Value)
+			}
+		case matrixfile.Directive:
+			if n.Name == "compat" {
+				if _, err := compat.Parse([]string{strings.Join(n.Args, " ")}); err != nil {
+					l.report(f, n.ArgPos[0], "%s", err.Error())
+				}
+			}
+		case matrixfile.External:
+			duplicate(n, "ext:"+n.Name, fmt.Sprintf("external mod '%s'", n.Name))
+
+			if !matrixfile.IsUrl(n.Url) {
+				l.report(f, n.Pos, "'%s' isn't a valid http or https URL", n.Url)
+			}
+		case matrixfile.Entry:
+			duplicate(n, n.IdOrSlug(), fmt.Sprintf("mod '%s'", n.IdOrSlug()))
+			l.entry(f, n)
+		case matrixfile.Include:
+			l.include(f, n)
+		}
+	}
+
+	if f.Legacy {
+		l.loader(f, matrixfile.Pos{File: f.Path, Line: 4, Col: 1}, f.Header.Loader)
+	}
+}
+
+func (l *linter) include(from *matrixfile.File, inc matrixfile.Include) {
+	if !l.online && (matrixfile.IsUrl(inc.Target) || matrixfile.IsUrl(inc.Pos.File)) {
+		return
+	}
+
+	name, content, err := matrixfile.ReadInclude(l.ctx)(inc.Pos.File, inc.Target)
+	if err != nil {
+		l.report(from, inc.Pos, "couldn't include '%s': %s", inc.Target, strings.TrimSpace(err.Error()))
+		return
+	} else if _, ok := l.checked[filepath.Clean(name)]; ok {
+		return
+	}
+
+	f, err := matrixfile.ParseFragment(name, content)
+	if err != nil {
+		l.problems = append(l.problems, err)
+		return
+	}
+
+	l.file(f)
+}
+
+// checks that every mod exists and has a version for the game version and loader
+func (l *linter) remote(root *matrixfile.File) {
+	rules := []string{}
+	ms := modrinthSource{modloader: root.Header.Loader, shaderLoader: "iris"}
+	target := matrixfile.Target{Loader: root.Header.Loader, GameVersion: root.Header.GameVersion}
+
+	for _, n := range root.Nodes {
+		if d, ok := n.(matrixfile.Directive); ok && d.Name == "compat" {
+			rules = append(rules, strings.Join(d.Args, " "))
+		} else if s, ok := n.(matrixfile.Setting); ok && s.Key == "shaderloader" {
+			ms.shaderLoader = strings.ToLower(s.Value)
+		}
+	}
+
+	table, err := compat.Parse(rules)
+	if err != nil {
+		// already reported by the offline checks
+		return
+	}
+
+	ms.compat = compat.Default().Merge(table)
+	mp := Modpack{shaderLoader: ms.shaderLoader, datapackDir: "datapacks"}
+
+	checked := map[string]struct{}{}
+
+	for _, p := range append([]string{""}, root.Profiles...) {
+		target.Profile = p
+
+		f, _, err := root.Flatten(matrixfile.ReadInclude(l.ctx), target)
+		if err != nil {
+			l.problems = append(l.problems, err)
+			return
+		}
+
+		for _, n := range f.Nodes {
+			e, ok := n.(matrixfile.Entry)
+			if !ok {
+				continue
+			} else if _, ok := checked[e.IdOrSlug()]; ok {
+				continue
+			}
+
+			checked[e.IdOrSlug()] = struct{}{}
+
+			available := []string{}
+			for _, alt := range append([]matrixfile.Entry{e}, e.Alternatives...) {
+				if l.project(f, ms, mp, alt, len(e.Alternatives) == 0) {
+					available = append(available, alt.IdOrSlug())
+				}
+			}
+
+			if len(available) == 0 && len(e.Alternatives) > 0 {
+				l.report(f, e.Pos, "none of the alternatives have a version for Minecraft %s with modloader %s", root.Header.GameVersion, root.Header.Loader)
+			}
+		}
+	}
+}
+
+// checks a single mod, returning whether it has a usable version. Alternatives are only reported if none of them are usable
+func (l *linter) project(f *matrixfile.File, ms modrinthSource, mp Modpack, e matrixfile.Entry, alone bool) bool {
+	loader, kind, forced := "", "", ""
+
+	for _, flag := range e.Flags {
+		switch flag.Key {
+		case "l":
+			loader = strings.ToLower(flag.Value)
+		case "t":
+			kind = flag.Value
+		case "v":
+			forced = flag.Value
+		}
+	}
+
+	if loader == "" && checkType(kind) == nil {
+		loader = mp.loaderFor(kind)
+	}
+
+	if loader == "" {
+		loader = ms.modloader
+	}
+
+	remote, err := ms.Project(l.ctx, e.IdOrSlug(), f.Header.GameVersion, loader)
+	if errors.Is(err, errs.ErrNotFound) {
+		msg := fmt.Sprintf("mod '%s' doesn't exist on Modrinth", e.IdOrSlug())
+
+		if hits, err := remotemod.Search(l.ctx, e.IdOrSlug(), 3); err == nil && len(hits) > 0 {
+			slugs := []string{}
+			for _, h := range hits {
+				slugs = append(slugs, "'"+h.Slug+"'")
+			}
+
+			msg += ", did you mean " + strings.Join(slugs, ", ") + "?"
+		}
+
+		l.report(f, e.Pos, "%s", msg)
+
+		return false
+	} else if err != nil {
+		l.report(f, e.Pos, "couldn't check mod '%s': %s", e.IdOrSlug(), strings.TrimSpace(err.Error()))
+		return false
+	}
+
+	if forced != "" {
+		// pinned versions are trusted even if they don't claim to support the game version
+		if v, err := remotemod.FromVersion(l.ctx, forced); err != nil {
+			l.report(f, e.Pos, "couldn't find version '%s' of '%s': %s", forced, e.IdOrSlug(), strings.TrimSpace(err.Error()))
+			return false
+		} else if v.ProjectId != remote.Id {
+			l.report(f, e.Pos, "version '%s' belongs to a different project than '%s'", forced, e.IdOrSlug())
+			return false
+		}
+
+		return true
+	}
+
+	if len(remote.Versions) == 0 {
+		if alone {
+			l.report(f, e.Pos, "mod '%s' has no versions for Minecraft %s with modloader %s", e.IdOrSlug(), f.Header.GameVersion, loader)
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// checks the Matrixfile for mistakes, and if online, that every mod can be found on Modrinth
+func Lint(ctx context.Context, f *matrixfile.File, online bool) []error {
+	l := linter{ctx: ctx, online: online, checked: map[string]struct{}{}}
+
+	l.file(f)
+
+	if online && len(l.problems) == 0 {
+		l.remote(f)
+	}
+
+	return l.problems
+}
@@ -1,132 +1,219 @@
 package modpack
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/BurntSushi/toml"
+	"github.com/voidwyrm-2/matrix/api/compat"
+	"github.com/voidwyrm-2/matrix/api/errs"
 	"github.com/voidwyrm-2/matrix/api/internal"
 	"github.com/voidwyrm-2/matrix/api/localmod"
+	"github.com/voidwyrm-2/matrix/api/matrixfile"
+	"github.com/voidwyrm-2/matrix/api/remotemod"
+	"github.com/voidwyrm-2/matrix/api/resolver"
 	"github.com/voidwyrm-2/matrix/api/version"
 )
 
-func errIs(e error, s string) bool {
-	if e == nil {
-		return false
-	}
-
-	return e.Error() == s
-}
-
 type Modpack struct {
 	onlySyncEmpty, ignoreExternals bool
 	name, desc, modloader          string
+	shaderLoader, datapackDir      string
 	version, gameVersion           version.Version
+	compatRules                    []string
+	compat                         compat.Table
+	overrides                      internal.PublicOverrides
+	includes, excludes, chain      []string
+	profileIncludes                map[string][]string
+	externalFrom                   map[string]string
+	profile, defaultProfile        string
+	profiles                       []string
+	externalProfiles               map[string][]string
 	mods                           struct {
 		mdrth    []localmod.LocalMod
 		external map[string]string
 	}
+	observer Observer
+	// where the pack is synced to, the working directory if empty
+	instanceDir string
+	// the least stable release channel versions are picked from, any if empty, and how many files are downloaded at once
+	channel     string
+	concurrency int
+	// the files that have been downloaded but not committed yet
+	stage *stage
+	// the sha1 hash of the matrix.toml the pack was read from, and the folder it's in
+	source, packDir string
+	// the sha1 hash of each external mod when it was last downloaded
+	externalHashes map[string]string
 }
 
-func (mp *Modpack) Populate() error {
-	os.Mkdir("mods", os.ModeDir|os.ModePerm)
+type modrinthSource struct {
+	compat                           compat.Table
+	modloader, shaderLoader, channel string
+}
 
-	err := mp.downloadMods(mp.mods.mdrth, map[string]struct{}{}, false)
+func (ms modrinthSource) Project(ctx context.Context, idOrSlug, gameVersion, modloader string) (remotemod.RemoteMod, error) {
+	remote, err := remotemod.Project(ctx, idOrSlug)
 	if err != nil {
-		return err
+		return remotemod.RemoteMod{}, err
 	}
 
-	if !mp.ignoreExternals {
-		for name, url := range mp.mods.external {
-			log.Printf("\033[93mdownloading external mod '%s'...\033[0m\n", name)
+	loaders := []string{modloader}
 
-			if resp, err := internal.Download(url); err != nil {
-				if strings.TrimSpace(err.Error()) == "status code 403, '403 Forbidden'" {
-					log.Printf("\033[91mexternal mod could not be downloaded, please remove or download manually: '%s' at '%s')\033[0m\n", name, url)
-					continue
-				}
-				return err
-			} else if err = internal.WriteFile(filepath.Join("mods", name), resp); err != nil {
-				return err
-			} else {
-				log.Printf("\033[92mdownloaded external mod '%s'\033[0m\n", name)
-			}
+	switch {
+	case remote.ProjectType == "resourcepack":
+		loaders = []string{"minecraft"}
+	case remote.ProjectType == "shader":
+		if modloader == ms.modloader {
+			loaders = []string{ms.shaderLoader}
 		}
+	case modloader != "datapack":
+		// data packs are published as mods, so they're only used if there's no actual mod
+		loaders = append(ms.compat.Loaders(modloader, gameVersion), "datapack")
 	}
 
-	existing := map[string]struct{}{}
-	cleanedMods := []localmod.LocalMod{}
+	// Modrinth only sends the versions for the game version and loaders, which are put in order here
+	remote.Versions, err = remotemod.ProjectVersions(ctx, remote.Id, gameVersion, loaders...)
+	if err != nil {
+		return remotemod.RemoteMod{}, err
+	}
 
-	for _, m := range mp.mods.mdrth {
-		if _, ok := existing[m.GetIdOrSlug()]; !ok && !m.IsEmpty() {
-			existing[m.GetIdOrSlug()] = struct{}{}
-			cleanedMods = append(cleanedMods, m)
-		} else {
-		}
+	remote.Versions = localmod.Candidates(remote, gameVersion, loaders...)
+
+	if ms.channel != "" {
+		remote.Versions = slices.DeleteFunc(remote.Versions, func(v remotemod.RemoteModVersion) bool { return !v.OnChannel(ms.channel) })
 	}
 
-	mp.mods.mdrth = cleanedMods
+	return remote, nil
+}
 
-	return nil
+func (modrinthSource) Version(ctx context.Context, id string) (remotemod.RemoteModVersion, error) {
+	return remotemod.FromVersion(ctx, id)
 }
 
-func (mp *Modpack) downloadMods(mods []localmod.LocalMod, alreadyDownloaded map[string]struct{}, downloadingDependencies bool) error {
-	kind := "mod"
-	if downloadingDependencies {
-		kind = "dependacy"
+// reports the progress of a download
+func (mp Modpack) progress(kind, mod string) func(done, total int64) {
+	return func(done, total int64) {
+		mp.notify(DownloadProgress{Kind: kind, Mod: mod, Bytes: done, Total: total})
 	}
+}
 
-	for i, m := range mods {
-		log.Printf("\033[93mdownloading %s '%s'...\033[0m\n", kind, m.GetIdOrSlug())
+// resolves every mod and dependency up front so nothing is downloaded unless the whole pack is consistent
+func (mp *Modpack) resolve(ctx context.Context) (resolver.Solution, error) {
+	roots := []resolver.Requirement{}
 
-		if mp.onlySyncEmpty && !m.IsEmpty() {
-			log.Printf("\033[94mskipped '%s' because only empty mods are being synced\033[0m\n", m.GetIdOrSlug())
+	for _, m := range mp.mods.mdrth {
+		if m.IsDependency() || m.GetIdOrSlug() == "" || !m.InProfile(mp.profile) {
 			continue
 		}
 
-		skipMod := m.AlreadyDownloaded(&alreadyDownloaded)
-		if skipMod {
-			log.Printf("\033[94mskipped '%s' because it's already been downloaded\033[0m\n", m.GetIdOrSlug())
-			continue
+		root := mp.requirement(m)
+		for _, a := range m.Alternatives() {
+			root.Alternatives = append(root.Alternatives, mp.requirement(a))
 		}
 
-		if mbytes, mname, dependancies, err := m.Download(mp.gameVersion.String(), mp.modloader); err != nil {
-			return err
-		} else if err = internal.WriteFile(filepath.Join("mods", mname), mbytes); err != nil {
-			return err
-		} else {
-			log.Printf("\033[92mdownloaded %s '%s'\033[0m\n", kind, mname)
-			alreadyDownloaded[m.ToPublic().Id], alreadyDownloaded[m.ToPublic().Slug] = struct{}{}, struct{}{}
+		roots = append(roots, root)
+	}
 
-			if downloadingDependencies {
-				mp.mods.mdrth = append(mp.mods.mdrth, m)
-			} else {
-				mp.mods.mdrth[i] = m
-			}
+	mp.notify(ResolveStarted{Mods: len(roots)})
 
-			dmods := []localmod.LocalMod{}
+	if err := mp.prefetch(ctx, roots); err != nil {
+		return resolver.Solution{}, err
+	}
 
-			for _, d := range dependancies {
-				if d.ProjectId == "P7dR8mSH" && mp.modloader != "fabric" && mp.modloader != "quilt" {
-					continue
-				}
+	src := modrinthSource{compat: mp.compat, modloader: mp.modloader, shaderLoader: mp.shaderLoader, channel: mp.channel}
 
-				if _, ok := alreadyDownloaded[d.ProjectId]; !ok && d.Kind == "required" {
-					dmods = append(dmods, localmod.NewWithoutVersion("", "", d.ProjectId, "", "", m.ToPublic().ForceLoader))
-				}
+	r := resolver.New(src, mp.gameVersion.String(), mp.modloader)
+	r.Skip = func(dep remotemod.RemoteModVersionDependency, modloader string) bool {
+		return mp.compat.Skip(dep.ProjectId, modloader)
+	}
+
+	sol, err := r.Resolve(ctx, roots)
+	if errors.Is(err, errs.ErrOffline) {
+		return resolver.Solution{}, mp.missing(ctx, src, roots, err)
+	} else if err != nil {
+		return resolver.Solution{}, err
+	}
+
+	mp.notify(Resolved{Picks: len(sol.Picks)})
+
+	for _, pick := range sol.Picks {
+		mp.notify(VersionChosen{Mod: pick.Mod.Slug, Version: pick.Version.VersionNumber, Loader: pick.Loader})
+	}
+
+	return sol, nil
+}
+
+// looks up everything the pack lists in a few bulk requests, so the resolver finds it already looked up
+// instead of asking for each mod on its own; anything this misses is just looked up on its own later
+func (mp *Modpack) prefetch(ctx context.Context, roots []resolver.Requirement) error {
+	projects, versions, hashes := []string{}, []string{}, []string{}
+
+	for _, root := range roots {
+		for _, req := range append([]resolver.Requirement{root}, root.Alternatives...) {
+			projects = append(projects, req.Project)
+			if req.Version != "" {
+				versions = append(versions, req.Version)
 			}
+		}
+	}
+
+	// the dependencies from the last sync, and the versions that were picked, are likely to be needed again
+	for _, m := range mp.mods.mdrth {
+		if m.IsDependency() && m.InProfile(mp.profile) {
+			projects = append(projects, m.GetIdOrSlug())
+		}
+
+		if _, _, sha1 := m.Active().Locked(); sha1 != "" {
+			hashes = append(hashes, sha1)
+		}
+	}
 
-			if err := mp.downloadMods(dmods, alreadyDownloaded, true); err != nil {
-				return err
+	// the errors come up again when what failed is looked up on its own, with the mod they're about
+	remotemod.Projects(ctx, projects)
+	remotemod.Versions(ctx, versions)
+	remotemod.FromHashes(ctx, hashes)
+
+	return ctx.Err()
+}
+
+// when offline, looks up every mod the pack lists so everything that isn't cached is listed at once,
+// instead of just the first thing the resolver needed
+func (mp *Modpack) missing(ctx context.Context, src modrinthSource, roots []resolver.Requirement, err error) error {
+	all := []error{err}
+
+	for _, root := range roots {
+		for _, req := range append([]resolver.Requirement{root}, root.Alternatives...) {
+			if req.Version != "" {
+				_, err = src.Version(ctx, req.Version)
+			} else {
+				_, err = src.Project(ctx, req.Project, mp.gameVersion.String(), req.Loader)
 			}
+
+			all = append(all, err)
 		}
 	}
 
-	return nil
+	return errs.Offline(errors.Join(all...))
+}
+
+func (mp *Modpack) requirement(m localmod.LocalMod) resolver.Requirement {
+	loader := m.ForceLoader()
+
+	if m.ForceVersion() != "" {
+		mp.notify(Notice{Mod: m.GetIdOrSlug(), Message: fmt.Sprintf("mod '%s' has been forced to use version '%s'", m.GetIdOrSlug(), m.ForceVersion())})
+	} else if loader != "" {
+		mp.notify(Notice{Mod: m.GetIdOrSlug(), Message: fmt.Sprintf("mod '%s' has been forced to use the modloader '%s'", m.GetIdOrSlug(), loader)})
+	} else {
+		loader = mp.loaderFor(m.ForceType())
+	}
+
+	return resolver.Requirement{Project: m.GetIdOrSlug(), Version: m.ForceVersion(), Loader: loader}
 }
 
 func (mp Modpack) Mods() []localmod.LocalMod {
@@ -149,11 +236,124 @@ func (mp Modpack) Modloader() string {
 	return mp.modloader
 }
 
+// the pack's own loader compatibility rules, not including the defaults
+func (mp Modpack) CompatRules() []string {
+	return mp.compatRules
+}
+
+func (mp Modpack) ShaderLoader() string {
+	return mp.shaderLoader
+}
+
+func (mp Modpack) DatapackDir() string {
+	return mp.datapackDir
+}
+
+func (mp Modpack) Overrides() internal.PublicOverrides {
+	return mp.overrides
+}
+
+// the includes and excludes as they were written in the Matrixfile
+func (mp Modpack) Includes() ([]string, []string) {
+	return mp.includes, mp.excludes
+}
+
+// the file an external mod was included from, empty if it was listed in the Matrixfile itself
+func (mp Modpack) ExternalFrom(name string) string {
+	return mp.externalFrom[name]
+}
+
+// picks which profile gets synced, "" for the one chosen when the matrix.toml was made
+func (mp *Modpack) SelectProfile(profile string) error {
+	if profile == "" {
+		return nil
+	} else if profile != DefaultProfile && !slices.Contains(mp.profiles, profile) {
+		return errs.Errorf(errs.ErrNotFound, "profile '%s' isn't in the matrix.toml", profile)
+	}
+
+	mp.profile = profile
+
+	return nil
+}
+
+// sets the folder the pack is synced to, e.g. a launcher's .minecraft folder
+func (mp *Modpack) SetInstanceDir(dir string) {
+	mp.instanceDir = dir
+}
+
+// only picks versions that are at least as stable as the channel, unless they're forced
+func (mp *Modpack) SetChannel(channel string) error {
+	if channel != "" && !slices.Contains(remotemod.Channels, channel) {
+		return fmt.Errorf("unknown release channel '%s', expected one of %v", channel, remotemod.Channels)
+	}
+
+	mp.channel = channel
+
+	return nil
+}
+
+// sets how many files are downloaded at once
+func (mp *Modpack) SetConcurrency(n int) error {
+	if n < 1 {
+		return fmt.Errorf("can't download %d files at once", n)
+	}
+
+	mp.concurrency = n
+
+	return nil
+}
+
+func (mp Modpack) InstanceDir() string {
+	return mp.instanceDir
+}
+
+// joins the path onto the instance folder
+func (mp Modpack) instancePath(elem ...string) string {
+	return filepath.Join(append([]string{mp.instanceDir}, elem...)...)
+}
+
+func (mp Modpack) Profile() string {
+	return mp.profile
+}
+
+func (mp Modpack) Profiles() []string {
+	return mp.profiles
+}
+
+// the profiles an external mod is in, empty if it's in all of them
+func (mp Modpack) ExternalProfiles(name string) []string {
+	return mp.externalProfiles[name]
+}
+
 func (mp Modpack) ToToml(name string) error {
+	result, err := mp.toToml()
+	if err != nil {
+		return err
+	}
+
+	return internal.WriteFile(name, result)
+}
+
+func (mp Modpack) toToml() ([]byte, error) {
 	pm := internal.PublicModpack{
-		Name:           mp.name,
-		ModpackVersion: mp.version.String(),
-		GameVersion:    mp.gameVersion.String(),
+		Schema:           Schema,
+		Name:             mp.name,
+		ModpackVersion:   mp.version.String(),
+		GameVersion:      mp.gameVersion.String(),
+		Modloader:        mp.modloader,
+		ShaderLoader:     mp.shaderLoader,
+		DatapackDir:      mp.datapackDir,
+		Compat:           mp.compatRules,
+		Overrides:        mp.overrides,
+		Includes:         mp.includes,
+		ProfileIncludes:  mp.profileIncludes,
+		Excludes:         mp.excludes,
+		IncludeChain:     mp.chain,
+		ExternalFrom:     mp.externalFrom,
+		Profile:          mp.defaultProfile,
+		Profiles:         mp.profiles,
+		ExternalProfiles: mp.externalProfiles,
+		ExternalHashes:   mp.externalHashes,
 		Mods: struct {
 			External map[string]string
 			Mdrth    []internal.PublicLocalMod
@@ -166,20 +366,11 @@ func (mp Modpack) ToToml(name string) error {
 		pm.Mods.Mdrth = append(pm.Mods.Mdrth, m.ToPublic())
 	}
 
-	result, err := toml.Marshal(pm)
-	if err != nil {
-		return err
-	}
-
-	os.Remove(name)
-
-	return internal.WriteFile(name, result)
+	return toml.Marshal(pm)
 }
 
 func FromToml(name string, onlySyncEmpty, ignoreExternals bool) (Modpack, error) {
-	st := internal.PublicModpack{}
-
-	_, err := toml.DecodeFile(name, &st)
+	st, _, err := readToml(name)
 	if err != nil {
 		return Modpack{}, err
 	}
@@ -194,58 +385,177 @@ func FromToml(name string, onlySyncEmpty, ignoreExternals bool) (Modpack, error)
 		return Modpack{}, err
 	}
 
-	mp := Modpack{name: st.Name, version: mpv, gameVersion: mcv, modloader: st.Modloader, mods: struct {
+	rules, err := compat.Parse(st.Compat)
+	if err != nil {
+		return Modpack{}, err
+	}
+
+	if st.ShaderLoader == "" {
+		st.ShaderLoader = "iris"
+	}
+
+	if st.DatapackDir == "" {
+		st.DatapackDir = "datapacks"
+	}
+
+	profile := st.Profile
+	if profile == "" {
+		profile = DefaultProfile
+	}
+
+	mp := Modpack{profile: profile, defaultProfile: st.Profile, profiles: st.Profiles, externalProfiles: st.ExternalProfiles, includes: st.Includes, excludes: st.Excludes, profileIncludes: st.ProfileIncludes, chain: st.IncludeChain, externalFrom: st.ExternalFrom, overrides: st.Overrides, shaderLoader: st.ShaderLoader, datapackDir: st.DatapackDir, compatRules: st.Compat, compat: compat.Default().Merge(rules), name: st.Name, version: mpv, gameVersion: mcv, modloader: st.Modloader, mods: struct {
 		mdrth    []localmod.LocalMod
 		external map[string]string
 	}{external: st.Mods.External}, onlySyncEmpty: onlySyncEmpty, ignoreExternals: ignoreExternals}
 
 	for _, m := range st.Mods.Mdrth {
-		lm := localmod.NewWithoutVersion(m.Name, m.Desc, m.Id, m.Slug, m.ForceVersion, m.ForceLoader)
-
-		if _lm, err := localmod.New(m.Name, m.Desc, m.Id, m.Slug, m.ForceVersion, m.ForceLoader, m.Version); err != nil && !errIs(err, `strconv.ParseUint: parsing "": invalid syntax`) {
+		lm, err := fromPublic(m)
+		if err != nil {
 			return Modpack{}, err
-		} else if err == nil {
-			lm = _lm
 		}
 
 		mp.mods.mdrth = append(mp.mods.mdrth, lm)
 	}
 
+	if content, err := os.ReadFile(name); err == nil {
+		mp.source = internal.Sha1(content)
+	}
+
+	mp.packDir = filepath.Dir(name)
+
+	mp.externalHashes = st.ExternalHashes
+
 	return mp, nil
 }
 
-func parseMatrixfileEntryFlags(rawFlags []string) map[string]string {
-	m := map[string]string{}
+func fromPublic(m internal.PublicLocalMod) (localmod.LocalMod, error) {
+	lm := localmod.NewWithoutVersion(m.Name, m.Desc, m.Id, m.Slug, m.ForceVersion, m.ForceLoader)
 
-	for _, f := range rawFlags {
-		if strings.Contains(f, ":") {
-			spl := strings.Split(f, ":")
-			if len(spl) > 1 {
-				m[strings.TrimSpace(spl[0])] = strings.TrimSpace(strings.Join(spl[1:], ":"))
-			}
+	// mods that haven't been synced yet don't have a version
+	if m.Version != "" {
+		_lm, err := localmod.New(m.Name, m.Desc, m.Id, m.Slug, m.ForceVersion, m.ForceLoader, m.Version)
+		if err != nil {
+			return localmod.LocalMod{}, err
 		}
+
+		lm = _lm
 	}
 
-	return m
+	if m.Dependency {
+		lm.MarkDependency()
+	}
+
+	lm.SetRequires(m.Requires)
+	lm.SetForceType(m.ForceType)
+	lm.SetFrom(m.From)
+	lm.SetProfiles(m.Profiles)
+	lm.SetType(m.Type)
+	lm.SetById(m.ById)
+	lm.SetFile(m.File)
+	lm.Lock(m.VersionId, m.Url, m.Sha1)
+
+	alternatives := []localmod.LocalMod{}
+	for _, a := range m.Alternatives {
+		alm, err := fromPublic(a)
+		if err != nil {
+			return localmod.LocalMod{}, err
+		}
+
+		alternatives = append(alternatives, alm)
+	}
+
+	if len(alternatives) > 0 {
+		lm.SetAlternatives(alternatives)
+	}
+
+	if m.Chosen != "" {
+		if err := lm.Choose(m.Chosen); err != nil {
+			return localmod.LocalMod{}, err
+		}
+	}
+
+	return lm, nil
 }
 
-func configureLocalMod(plm *internal.PublicLocalMod, flags map[string]string) {
-	if v, ok := flags["v"]; ok {
-		plm.ForceVersion = v
+func configureLocalMod(f *matrixfile.File, plm *internal.PublicLocalMod, e matrixfile.Entry) error {
+	plm.ById = e.Slug == ""
+
+	for _, flag := range e.Flags {
+		switch flag.Key {
+		case "v":
+			plm.ForceVersion = flag.Value
+		case "l":
+			plm.ForceLoader = flag.Value
+		case "t":
+			if err := checkType(flag.Value); err != nil {
+				return f.Errorf(flag.Pos, "%s", err)
+			}
+
+			plm.ForceType = flag.Value
+		}
 	}
 
-	if v, ok := flags["l"]; ok {
-		plm.ForceLoader = v
+	for _, alt := range e.Alternatives {
+		a := internal.PublicLocalMod{Id: alt.Id, Slug: alt.Slug}
+		if err := configureLocalMod(f, &a, alt); err != nil {
+			return err
+		}
+
+		plm.Alternatives = append(plm.Alternatives, a)
 	}
+
+	return nil
 }
 
-func FromMatrixfile(name string) error {
-	content, err := internal.ReadOptions("Matrixfile", "matrixfile", "Matrixfile.txt", "matrixfile.txt")
+const DefaultProfile = "default"
+
+// generates the matrix.toml from the Matrixfile at source (or the one in the working directory if it's empty), profile being the one that's synced when none is given.
+// loader and gameVersion override the ones in the header when they aren't empty, and are what conditions are checked against
+func FromMatrixfile(ctx context.Context, name, source, profile, loader, gameVersion string) error {
+	pm, err := fromMatrixfile(ctx, filepath.Dir(name), source, profile, loader, gameVersion)
 	if err != nil {
 		return err
 	}
 
+	result, err := toml.Marshal(pm)
+	if err != nil {
+		return err
+	}
+
+	return internal.WriteFile(name, result)
+}
+
+// the matrix.toml the Matrixfile makes, before anything's been synced, with the overrides relative to packDir
+func fromMatrixfile(ctx context.Context, packDir, source, profile, loader, gameVersion string) (internal.PublicModpack, error) {
+	root, _, err := matrixfile.Open(source)
+	if err != nil {
+		return internal.PublicModpack{}, err
+	}
+
+	if loader != "" {
+		root.Header.Loader = strings.ToLower(loader)
+	}
+
+	if gameVersion != "" {
+		root.Header.GameVersion = gameVersion
+	}
+
+	target := matrixfile.Target{Loader: root.Header.Loader, GameVersion: root.Header.GameVersion}
+
+	f, chain, err := root.Flatten(matrixfile.ReadInclude(ctx), target)
+	if err != nil {
+		return internal.PublicModpack{}, err
+	}
+
 	pm := internal.PublicModpack{
+		Schema:           Schema,
+		Name:             f.Header.Name,
+		ModpackVersion:   f.Header.Version,
+		GameVersion:      f.Header.GameVersion,
+		Modloader:        f.Header.Loader,
+		IncludeChain:     chain,
+		ExternalFrom:     map[string]string{},
+		ExternalProfiles: map[string][]string{},
 		Mods: struct {
 			External map[string]string
 			Mdrth    []internal.PublicLocalMod
@@ -254,72 +564,163 @@ func FromMatrixfile(name string) error {
 		},
 	}
 
-	if len(strings.Split(strings.TrimSpace(string(content)), "\n")) < 4 {
-		return errors.New(`invalid Matrixfile format, expected
-<name>
-<pack version>
-<Minecraft version>
-<modloader>
+	if profile != "" && profile != DefaultProfile && !slices.Contains(f.Profiles, profile) {
+		return internal.PublicModpack{}, errs.Errorf(errs.ErrNotFound, "profile '%s' isn't used in the Matrixfile", profile)
+	} else if profile != DefaultProfile {
+		pm.Profile = profile
+	}
 
-(<slug> OR id <id>) [flags...]
-...`)
+	if len(f.Profiles) > 0 {
+		pm.Profiles = append([]string{DefaultProfile}, f.Profiles...)
 	}
 
-	realI := 0
-	for i, l := range strings.Split(strings.TrimSpace(string(content)), "\n") {
-		l = strings.TrimSpace(l)
-		if l == "" {
+	section := ""
+
+	for _, n := range root.Nodes {
+		if ok, err := matrixfile.Holds(n, target); err != nil {
+			return internal.PublicModpack{}, err
+		} else if !ok {
 			continue
 		}
 
-		if realI == 0 {
-			pm.Name = l
-		} else if realI == 1 {
-			pm.ModpackVersion = l
-		} else if realI == 2 {
-			pm.GameVersion = l
-		} else if realI == 3 {
-			pm.Modloader = strings.ToLower(l)
-		} else {
-			m := internal.PublicLocalMod{}
+		switch n := n.(type) {
+		case matrixfile.Profile:
+			section = n.Name
+		case matrixfile.Include:
+			if section != "" {
+				if pm.ProfileIncludes == nil {
+					pm.ProfileIncludes = map[string][]string{}
+				}
 
-			spl := strings.Split(l, " ")
+				pm.ProfileIncludes[section] = append(pm.ProfileIncludes[section], n.Target)
+			} else {
+				pm.Includes = append(pm.Includes, n.Target)
+			}
+		case matrixfile.Exclude:
+			// excludes in a profile are worked out from the profiles each mod is in
+			if section == "" {
+				pm.Excludes = append(pm.Excludes, n.Key)
+			}
+		}
+	}
+
+	from := func(pos matrixfile.Pos) string {
+		if pos.File == root.Path {
+			return ""
+		}
+
+		return pos.File
+	}
 
-			switch spl[0] {
-			case "ext", "external":
-				if len(spl) < 3 {
-					return fmt.Errorf("line %d: expected 3 items, but found %d", i+1, len(spl))
+	for _, n := range f.Nodes {
+		switch n := n.(type) {
+		case matrixfile.Setting:
+			switch n.Key {
+			case "shaderloader":
+				pm.ShaderLoader = strings.ToLower(n.Value)
+			case "datapacks":
+				pm.DatapackDir = n.Value
+			}
+		case matrixfile.Directive:
+			switch n.Name {
+			case "compat":
+				rule := strings.Join(n.Args, " ")
+				if _, err := compat.Parse([]string{rule}); err != nil {
+					return internal.PublicModpack{}, f.Errorf(n.ArgPos[0], "%s", err)
 				}
 
-				pm.Mods.External[spl[1]] = spl[2]
-			case "id":
-				if len(spl) < 2 {
-					return fmt.Errorf("line %d: expected 2 items, but found %d", i+1, len(spl))
+				pm.Compat = append(pm.Compat, rule)
+			case "overrides":
+				switch {
+				case len(n.Args) == 1:
+					pm.Overrides.Common = n.Args[0]
+				case len(n.Args) == 2 && n.Args[0] == SideClient:
+					pm.Overrides.Client = n.Args[1]
+				case len(n.Args) == 2 && n.Args[0] == SideServer:
+					pm.Overrides.Server = n.Args[1]
+				default:
+					return internal.PublicModpack{}, f.Errorf(n.Pos, "expected 'overrides [client|server] <folder>'")
 				}
+			}
+		}
+	}
 
-				configureLocalMod(&m, parseMatrixfileEntryFlags(spl[2:]))
+	// every profile is flattened separately, and each mod records which of them it ended up in
+	modProfiles, externalProfiles := map[string][]string{}, map[string][]string{}
+	modKeys := []string{}
 
-				m.Id = spl[1]
-			default:
-				configureLocalMod(&m, parseMatrixfileEntryFlags(spl[1:]))
+	for _, p := range append([]string{""}, f.Profiles...) {
+		variant := f
 
-				m.Slug = spl[0]
+		if p != "" {
+			target.Profile = p
+			if variant, _, err = root.Flatten(matrixfile.ReadInclude(ctx), target); err != nil {
+				return internal.PublicModpack{}, err
 			}
+		} else {
+			p = DefaultProfile
+		}
+
+		for _, n := range variant.Nodes {
+			switch n := n.(type) {
+			case matrixfile.External:
+				if _, ok := externalProfiles[n.Name]; !ok {
+					pm.Mods.External[n.Name] = n.Url
+				}
+
+				externalProfiles[n.Name] = append(externalProfiles[n.Name], p)
+
+				if origin := from(n.Pos); origin != "" {
+					pm.ExternalFrom[n.Name] = origin
+				}
+			case matrixfile.Entry:
+				m := internal.PublicLocalMod{Id: n.Id, Slug: n.Slug, From: from(n.Pos)}
+
+				if err := configureLocalMod(variant, &m, n); err != nil {
+					return internal.PublicModpack{}, err
+				}
 
-			if m.Slug != "" || m.Id != "" {
-				pm.Mods.Mdrth = append(pm.Mods.Mdrth, m)
+				// the same entry in several profiles is one mod that's in each of them
+				key := declared(m)
+
+				if _, ok := modProfiles[key]; !ok {
+					modKeys = append(modKeys, key)
+					pm.Mods.Mdrth = append(pm.Mods.Mdrth, m)
+				}
+
+				modProfiles[key] = append(modProfiles[key], p)
 			}
 		}
+	}
 
-		realI++
+	for i, key := range modKeys {
+		if len(modProfiles[key]) < len(f.Profiles)+1 {
+			pm.Mods.Mdrth[i].Profiles = modProfiles[key]
+		}
 	}
 
-	result, err := toml.Marshal(pm)
-	if err != nil {
-		return err
+	for name, profiles := range externalProfiles {
+		if len(profiles) < len(f.Profiles)+1 {
+			pm.ExternalProfiles[name] = profiles
+		}
 	}
 
-	os.Remove(name)
+	for _, o := range []struct {
+		set *string
+		dir string
+	}{
+		{&pm.Overrides.Common, defaultOverrides.Common},
+		{&pm.Overrides.Client, defaultOverrides.Client},
+		{&pm.Overrides.Server, defaultOverrides.Server},
+	} {
+		// they're next to the Matrixfile, which isn't always in the working directory
+		if info, err := os.Stat(filepath.Join(filepath.Dir(root.Path), o.dir)); *o.set == "" && err == nil && info.IsDir() {
+			*o.set = o.dir
+		}
+
+		// and so are the ones it names, but the matrix.toml might be somewhere else
+		*o.set = rebase(*o.set, filepath.Dir(root.Path), packDir)
+	}
 
-	return internal.WriteFile(name, result)
+	return pm, nil
 }
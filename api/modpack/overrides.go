@@ -0,0 +1,168 @@
+package modpack
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/voidwyrm-2/matrix/api/internal"
+)
+
+const (
+	SideClient = "client"
+	SideServer = "server"
+)
+
+// the folders that are used as overrides by default if they exist next to the Matrixfile
+var defaultOverrides = internal.PublicOverrides{Common: "overrides", Client: "client-overrides", Server: "server-overrides"}
+
+// moves a folder that's relative to from so it's relative to to instead, leaving absolute ones alone
+func rebase(dir, from, to string) string {
+	if dir == "" || filepath.IsAbs(dir) {
+		return dir
+	}
+
+	rel, err := filepath.Rel(to, filepath.Join(from, dir))
+	if err != nil {
+		return filepath.Join(from, dir)
+	}
+
+	return rel
+}
+
+// the override folders are relative to the matrix.toml, not the working directory
+func (mp Modpack) overrideDirs(side string) []string {
+	dirs := []string{mp.overrides.Common}
+
+	switch side {
+	case SideClient:
+		dirs = append(dirs, mp.overrides.Client)
+	case SideServer:
+		dirs = append(dirs, mp.overrides.Server)
+	}
+
+	dirs = slices.DeleteFunc(dirs, func(d string) bool { return d == "" })
+	for i, d := range dirs {
+		dirs[i] = rebase(d, mp.packDir, ".")
+	}
+
+	return dirs
+}
+
+// maps every overridden file, relative to the instance, to the file it's copied from; side specific files win
+func (mp Modpack) overrideFiles(side string) (map[string]string, []string, error) {
+	files := map[string]string{}
+	order := []string{}
+
+	for _, dir := range mp.overrideDirs(side) {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue
+		}
+
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+
+			rel = filepath.ToSlash(rel)
+			if _, ok := files[rel]; !ok {
+				order = append(order, rel)
+			}
+
+			files[rel] = path
+
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return files, order, nil
+}
+
+// stages the overrides for the given side to be copied into the instance by Commit,
+// refusing to replace files that were changed since the last time they were copied unless forced
+func (mp *Modpack) ApplyOverrides(ctx context.Context, side string, force bool) (err error) {
+	defer func() {
+		if err != nil {
+			mp.Discard()
+		}
+	}()
+
+	if side != SideClient && side != SideServer {
+		return fmt.Errorf("unknown side '%s', expected '%s' or '%s'", side, SideClient, SideServer)
+	}
+
+	files, order, err := mp.overrideFiles(side)
+	if err != nil {
+		return err
+	}
+
+	type copyJob struct {
+		dst     string
+		content []byte
+	}
+
+	jobs := []copyJob{}
+	edited := []string{}
+	hashes := map[string]string{}
+
+	for _, rel := range order {
+		content, err := os.ReadFile(files[rel])
+		if err != nil {
+			return err
+		}
+
+		hash := internal.Sha1(content)
+		hashes[rel] = hash
+
+		dst := mp.instancePath(filepath.FromSlash(rel))
+
+		if existing, err := os.ReadFile(dst); err == nil {
+			existingHash := internal.Sha1(existing)
+			if existingHash == hash {
+				continue
+			} else if existingHash != mp.overrides.Hashes[rel] {
+				edited = append(edited, rel)
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		jobs = append(jobs, copyJob{dst: dst, content: content})
+	}
+
+	if len(edited) > 0 && !force {
+		return fmt.Errorf("these files were changed since they were last synced and would be overwritten by the overrides, use --force to overwrite them anyway:\n  %s", strings.Join(edited, "\n  "))
+	}
+
+	for _, job := range jobs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		mp.notify(OverrideStarted{File: filepath.ToSlash(job.dst)})
+
+		if err := mp.write(job.dst, job.content); err != nil {
+			return err
+		}
+	}
+
+	if len(jobs) > 0 {
+		mp.notify(OverridesCopied{Count: len(jobs)})
+	}
+
+	mp.overrides.Hashes = hashes
+
+	return nil
+}
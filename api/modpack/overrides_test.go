@@ -0,0 +1,97 @@
+package modpack
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/voidwyrm-2/matrix/api/internal"
+)
+
+func TestDefaultOverrides(t *testing.T) {
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+
+	os.Chdir(t.TempDir())
+	os.MkdirAll(filepath.Join("pack", "overrides"), os.ModePerm)
+	os.MkdirAll("client-overrides", os.ModePerm)
+	os.WriteFile(filepath.Join("pack", "Matrixfile"), []byte("name = a\nversion = 1.0\ngame = 1.21.1\nloader = fabric\n"), 0644)
+
+	// the folders next to the Matrixfile are used, not the ones in the working directory
+	pm, err := fromMatrixfile(context.Background(), ".", filepath.Join("pack", "Matrixfile"), "", "", "")
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if pm.Overrides.Common != filepath.Join("pack", "overrides") || pm.Overrides.Client != "" {
+		t.Fatalf("expected only pack/overrides to be used, but got %+v", pm.Overrides)
+	}
+
+	// they're stored relative to the matrix.toml, so it can be used from anywhere
+	name := filepath.Join("pack", "matrix.toml")
+	if err := FromMatrixfile(context.Background(), name, filepath.Join("pack", "Matrixfile"), "", "", ""); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	mp, err := FromToml(name, false, false)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if mp.Overrides().Common != "overrides" {
+		t.Fatalf("expected the overrides to be stored as `overrides`, but got `%s`", mp.Overrides().Common)
+	}
+
+	os.Chdir("client-overrides")
+
+	mp, err = FromToml(filepath.Join("..", name), false, false)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if dirs := mp.overrideDirs(SideClient); len(dirs) != 1 || dirs[0] != filepath.Join("..", "pack", "overrides") {
+		t.Fatalf("expected the overrides to be found in ../pack/overrides, but got %v", dirs)
+	}
+}
+
+func TestEditedOverrides(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "overrides"), os.ModePerm)
+	os.WriteFile(filepath.Join(dir, "overrides", "options.txt"), []byte("a"), 0644)
+
+	mp := Modpack{instanceDir: filepath.Join(dir, "instance"), overrides: internal.PublicOverrides{Common: filepath.Join(dir, "overrides")}}
+	options := filepath.Join(dir, "instance", "options.txt")
+
+	sync := func(force bool) error {
+		if err := mp.ApplyOverrides(context.Background(), SideClient, force); err != nil {
+			return err
+		}
+
+		return mp.Commit(filepath.Join(dir, "matrix.toml"))
+	}
+
+	if err := sync(false); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// a file that wasn't changed in the instance is updated
+	os.WriteFile(filepath.Join(dir, "overrides", "options.txt"), []byte("b"), 0644)
+
+	if err := sync(false); err != nil {
+		t.Fatal(err.Error())
+	} else if content, _ := os.ReadFile(options); string(content) != "b" {
+		t.Fatalf("expected options.txt to be `b`, but got `%s`", content)
+	}
+
+	// a file that was changed in the instance is only overwritten with force
+	os.WriteFile(options, []byte("mine"), 0644)
+	os.WriteFile(filepath.Join(dir, "overrides", "options.txt"), []byte("c"), 0644)
+
+	if err := sync(false); err == nil || !strings.Contains(err.Error(), "options.txt") {
+		t.Fatalf("expected the changed file to be refused, but got `%v`", err)
+	} else if content, _ := os.ReadFile(options); string(content) != "mine" {
+		t.Fatalf("expected options.txt to be left alone, but got `%s`", content)
+	}
+
+	if err := sync(true); err != nil {
+		t.Fatal(err.Error())
+	} else if content, _ := os.ReadFile(options); string(content) != "c" {
+		t.Fatalf("expected options.txt to be overwritten, but got `%s`", content)
+	}
+}
@@ -0,0 +1,460 @@
+package modpack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/voidwyrm-2/matrix/api/errs"
+	"github.com/voidwyrm-2/matrix/api/internal"
+	"github.com/voidwyrm-2/matrix/api/localmod"
+	"github.com/voidwyrm-2/matrix/api/logging"
+	"github.com/voidwyrm-2/matrix/api/remotemod"
+	"github.com/voidwyrm-2/matrix/api/resolver"
+)
+
+// what a sync does to a mod
+const (
+	ActionInstall   = "install"
+	ActionUpgrade   = "upgrade"
+	ActionDowngrade = "downgrade"
+	// the same version, whose file is missing or was changed
+	ActionReinstall = "reinstall"
+	ActionRemove    = "remove"
+)
+
+// something a sync does to one mod
+type Change struct {
+	Action string `json:"action"`
+	Kind   string `json:"kind"`
+	Mod    string `json:"mod"`
+	// the version that's there now and the one there'll be afterwards
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	// what's downloaded and where it goes, relative to the instance
+	Url  string `json:"url,omitempty"`
+	File string `json:"file,omitempty"`
+	Sha1 string `json:"sha1,omitempty"`
+	Size int64  `json:"size,omitempty"`
+	// the file that's removed, or replaced by one with a different name
+	Old string `json:"old,omitempty"`
+}
+
+// what a sync will do, which is worked out by Plan and carried out by Apply
+type Plan struct {
+	// the sha1 hash of the matrix.toml it was made from, so it can't be applied to a different one
+	Pack    string   `json:"pack"`
+	Profile string   `json:"profile"`
+	Changes []Change `json:"changes"`
+	// how many mods are already up to date, and how much will be downloaded
+	Unchanged int   `json:"unchanged"`
+	Bytes     int64 `json:"bytes"`
+	// the mods the matrix.toml will list afterwards
+	Mods []internal.PublicLocalMod `json:"mods"`
+}
+
+// reads a plan written by WriteJson
+func ReadPlan(name string) (Plan, error) {
+	plan := Plan{}
+
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return plan, err
+	}
+
+	if err := json.Unmarshal(content, &plan); err != nil {
+		return plan, errs.Errorf(errs.ErrParse, "%s: %s", name, err.Error())
+	}
+
+	return plan, nil
+}
+
+func (p Plan) WriteJson(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(p)
+}
+
+// writes the changes as a table, followed by a summary
+func (p Plan) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	if len(p.Changes) > 0 {
+		fmt.Fprintln(tw, "ACTION\tKIND\tMOD\tFROM\tTO\tSIZE")
+	}
+
+	for _, c := range p.Changes {
+		size := ""
+		if c.Size > 0 {
+			size = logging.Size(c.Size)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Action, c.Kind, c.Mod, c.From, c.To, size)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	counts := map[string]int{}
+	for _, c := range p.Changes {
+		counts[c.Action]++
+	}
+
+	_, err := fmt.Fprintf(w, "%d to install, %d to upgrade, %d to downgrade, %d to reinstall, %d to remove, %d unchanged, %s to download\n",
+		counts[ActionInstall], counts[ActionUpgrade], counts[ActionDowngrade], counts[ActionReinstall], counts[ActionRemove], p.Unchanged, logging.Size(p.Bytes))
+
+	return err
+}
+
+// resolves the pack and works out what syncing it would change, without touching the instance
+func (mp *Modpack) Plan(ctx context.Context) (Plan, error) {
+	// everything is looked up again each time, so a pack that's planned more than once sees what changed on Modrinth
+	ctx = remotemod.WithMemo(ctx)
+
+	sol, err := mp.resolve(ctx)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	plan := Plan{Pack: mp.source, Profile: mp.profile}
+	mods := []localmod.LocalMod{}
+	planned := map[string]struct{}{}
+
+	for _, m := range mp.mods.mdrth {
+		if m.IsDependency() || m.GetIdOrSlug() == "" {
+			continue
+		} else if !m.InProfile(mp.profile) {
+			// mods from other profiles are kept as they are so syncing a profile doesn't lose the others
+			mods = append(mods, m)
+			continue
+		}
+
+		pick, _ := sol.Get(m.GetIdOrSlug())
+
+		if len(m.Alternatives()) > 0 {
+			chosen := sol.Chosen(m.GetIdOrSlug())
+			if err := m.Choose(chosen); err != nil {
+				return Plan{}, err
+			}
+
+			if m.Chosen() != "" {
+				mp.notify(Notice{Mod: m.GetIdOrSlug(), Message: fmt.Sprintf("using '%s' instead of '%s', since it's the first alternative with a compatible version", chosen, m.GetIdOrSlug())})
+			}
+		}
+
+		// the same mod listed twice, like once by its slug and once by its id, is only kept once
+		if _, ok := planned[pick.Mod.Id]; ok {
+			continue
+		}
+
+		planned[pick.Mod.Id] = struct{}{}
+
+		if err := mp.planMod(&plan, &m, pick, ""); err != nil {
+			return Plan{}, err
+		}
+
+		mods = append(mods, m)
+	}
+
+	for _, pick := range sol.Picks {
+		if _, ok := planned[pick.Mod.Id]; ok {
+			continue
+		}
+
+		loader := pick.Loader
+		if loader == mp.modloader {
+			loader = ""
+		}
+
+		m := localmod.NewDependency(pick.Mod.Id, loader)
+		if err := mp.planMod(&plan, &m, pick, "dependency"); err != nil {
+			return Plan{}, err
+		}
+
+		mods = append(mods, m)
+	}
+
+	// the mods that were synced before but aren't picked anymore
+	for _, m := range mp.mods.mdrth {
+		a := m.Active()
+		if !m.InProfile(mp.profile) || a.File() == "" || slices.ContainsFunc(sol.Picks, func(p resolver.Pick) bool { return a.Matches(p.Mod) }) {
+			continue
+		}
+
+		kind := a.Type()
+		if m.IsDependency() {
+			kind = "dependency"
+		}
+
+		plan.Changes = append(plan.Changes, Change{Action: ActionRemove, Kind: kind, Mod: a.GetIdOrSlug(), From: a.Version().String(), Old: a.File()})
+	}
+
+	if !mp.ignoreExternals {
+		for _, name := range sortedKeys(mp.mods.external) {
+			if profiles, ok := mp.externalProfiles[name]; ok && !slices.Contains(profiles, mp.profile) {
+				continue
+			}
+
+			// there's no telling if an external mod changed, so it's only downloaded if it's missing
+			file := path.Join("mods", name)
+			if _, err := os.Stat(mp.instancePath(filepath.FromSlash(file))); err == nil {
+				plan.Unchanged++
+				continue
+			}
+
+			plan.Changes = append(plan.Changes, Change{Action: ActionInstall, Kind: KindExternal, Mod: name, Url: mp.mods.external[name], File: file})
+		}
+	}
+
+	requires := map[string][]string{}
+
+	for _, pick := range sol.Picks {
+		for _, by := range pick.RequiredBy {
+			if by != "" {
+				requires[by] = append(requires[by], pick.Mod.Slug)
+			}
+		}
+	}
+
+	existing := map[string]struct{}{}
+
+	for _, m := range mods {
+		if pick, ok := sol.Get(m.GetIdOrSlug()); ok {
+			m.SetRequires(requires[pick.Mod.Id])
+		}
+
+		// mods from other profiles haven't necessarily been synced yet, so they're kept even if they're empty
+		if _, ok := existing[m.GetIdOrSlug()]; !ok && m.GetIdOrSlug() != "" {
+			existing[m.GetIdOrSlug()] = struct{}{}
+			plan.Mods = append(plan.Mods, m.ToPublic())
+		}
+	}
+
+	return plan, nil
+}
+
+// works out what syncing a mod changes, filling in the mod as it'll be afterwards
+func (mp *Modpack) planMod(plan *Plan, m *localmod.LocalMod, pick resolver.Pick, kind string) error {
+	m = m.Active()
+	m.SetType(mp.detectType(pick.Mod, pick.Version, pick.Loader, m.ForceType()))
+
+	if kind == "" {
+		kind = m.Type()
+	}
+
+	if mp.onlySyncEmpty && !m.IsEmpty() {
+		mp.notify(Skipped{Mod: m.GetIdOrSlug(), Reason: "only empty mods are being synced"})
+		return nil
+	} else if len(pick.Version.Files) == 0 {
+		return errs.Errorf(errs.ErrNotFound, "version '%s' of '%s' has no files", pick.Version.VersionNumber, pick.Mod.Slug)
+	}
+
+	f := pick.Version.Files[0]
+	prev := mp.previous(pick.Mod)
+
+	m.Apply(pick.Mod, pick.Version)
+	m.SetFile(path.Join(mp.dir(m.Type()), f.Filename))
+
+	c := Change{Action: ActionInstall, Kind: kind, Mod: pick.Mod.Slug, To: pick.Version.VersionNumber, Url: f.Url, File: m.File(), Sha1: f.Hashes["sha1"], Size: f.Size}
+
+	if prev != nil && prev.Version().String() != "" {
+		c.From = prev.Version().String()
+
+		switch m.Version().Compare(prev.Version()) {
+		case 1:
+			c.Action = ActionUpgrade
+		case -1:
+			c.Action = ActionDowngrade
+		default:
+			c.Action = ActionReinstall
+		}
+	}
+
+	// checked even if the last version couldn't be parsed, so its file isn't left behind
+	if prev != nil && prev.File() != "" && prev.File() != c.File {
+		c.Old = prev.File()
+	}
+
+	if c.Old == "" && c.Sha1 != "" {
+		if content, err := os.ReadFile(mp.instancePath(filepath.FromSlash(c.File))); err == nil && internal.Sha1(content) == c.Sha1 {
+			plan.Unchanged++
+			return nil
+		}
+	}
+
+	plan.Changes = append(plan.Changes, c)
+	plan.Bytes += c.Size
+
+	return nil
+}
+
+// the mod as it was after the last sync, nil if it wasn't in the pack
+func (mp Modpack) previous(remote remotemod.RemoteMod) *localmod.LocalMod {
+	for i := range mp.mods.mdrth {
+		if a := mp.mods.mdrth[i].Active(); a.Matches(remote) {
+			return a
+		}
+	}
+
+	return nil
+}
+
+// downloads and removes what the plan says into the stage, which Commit moves into the instance;
+// if it fails or ctx is cancelled, everything that was staged is thrown away and the pack isn't changed
+func (mp *Modpack) Apply(ctx context.Context, plan Plan) (err error) {
+	defer func() {
+		if err != nil {
+			mp.Discard()
+		}
+	}()
+
+	if plan.Pack != mp.source {
+		return errs.Errorf(errs.ErrIncompatible, "the plan was made for a different matrix.toml")
+	} else if plan.Profile != mp.profile {
+		return errs.Errorf(errs.ErrIncompatible, "the plan is for the profile '%s', not '%s'", plan.Profile, mp.profile)
+	}
+
+	mods := []localmod.LocalMod{}
+	for _, m := range plan.Mods {
+		lm, err := fromPublic(m)
+		if err != nil {
+			return err
+		}
+
+		mods = append(mods, lm)
+	}
+
+	for _, c := range plan.Changes {
+		if c.Old != "" {
+			if err := mp.remove(mp.instancePath(filepath.FromSlash(c.Old))); err != nil {
+				return err
+			}
+		}
+	}
+
+	hashes, err := mp.downloadAll(ctx, plan.Changes)
+	if err != nil {
+		return errs.Offline(err)
+	}
+
+	mp.mods.mdrth = mods
+
+	// external mods have no hash to check them against, so the one they had when they were downloaded is kept for 'install --frozen';
+	// one that couldn't be downloaded is kept without one, so it's skipped there too
+	for i, c := range plan.Changes {
+		if c.Kind == KindExternal {
+			if mp.externalHashes == nil {
+				mp.externalHashes = map[string]string{}
+			}
+
+			mp.externalHashes[c.Mod] = hashes[i]
+		}
+	}
+
+	for name := range mp.externalHashes {
+		if _, ok := mp.mods.external[name]; !ok {
+			delete(mp.externalHashes, name)
+		}
+	}
+
+	mp.notify(Done{Mods: len(mods)})
+
+	return nil
+}
+
+// plans and applies a sync in one go
+func (mp *Modpack) Populate(ctx context.Context) error {
+	plan, err := mp.Plan(ctx)
+	if err != nil {
+		return err
+	}
+
+	return mp.Apply(ctx, plan)
+}
+
+// downloads the changes that have a file, mp.concurrency at a time, returning the sha1 hash of each file and every error;
+// the first error cancels the downloads that are left
+func (mp *Modpack) downloadAll(ctx context.Context, changes []Change) ([]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	slots := make(chan struct{}, max(mp.concurrency, 1))
+	failed := make([]error, len(changes))
+	hashes := make([]string, len(changes))
+	wg := sync.WaitGroup{}
+
+	for i, c := range changes {
+		if c.Url == "" {
+			continue
+		}
+
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			hashes[i], failed[i] = mp.download(ctx, c)
+
+			// files that aren't cached while offline don't stop the rest, so they can all be listed
+			if failed[i] != nil && !errors.Is(failed[i], errs.ErrOffline) {
+				cancel()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if err := errors.Join(failed...); err != nil {
+		return nil, err
+	}
+
+	// cancelled before any download failed
+	return hashes, context.Cause(ctx)
+}
+
+func (mp *Modpack) download(ctx context.Context, c Change) (string, error) {
+	mp.notify(DownloadStarted{Kind: c.Kind, Mod: c.Mod, Version: c.To, Url: c.Url})
+
+	f := remotemod.RemoteModVersionFile{Filename: path.Base(c.File), Url: c.Url}
+	if c.Sha1 != "" {
+		f.Hashes = map[string]string{"sha1": c.Sha1}
+	}
+
+	content, err := localmod.Download(ctx, f, mp.progress(c.Kind, c.Mod))
+	if err != nil {
+		// some sites don't allow downloading without a browser, which shouldn't stop the rest of the sync
+		var netErr *errs.NetworkError
+		skipped := c.Kind == KindExternal && errors.As(err, &netErr) && netErr.StatusCode == http.StatusForbidden
+
+		mp.notify(Failed{Kind: c.Kind, Mod: c.Mod, Url: c.Url, Err: err, Skipped: skipped})
+
+		if skipped {
+			return "", nil
+		}
+
+		return "", err
+	} else if err := mp.write(mp.instancePath(filepath.FromSlash(c.File)), content); err != nil {
+		return "", err
+	}
+
+	mp.notify(Downloaded{Kind: c.Kind, Mod: c.Mod, Version: c.To, File: path.Base(c.File)})
+
+	return internal.Sha1(content), nil
+}
@@ -0,0 +1,218 @@
+package modpack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/voidwyrm-2/matrix/api/errs"
+	"github.com/voidwyrm-2/matrix/api/internal"
+	"github.com/voidwyrm-2/matrix/api/localmod"
+	"github.com/voidwyrm-2/matrix/api/remotemod"
+	"github.com/voidwyrm-2/matrix/api/version"
+)
+
+func TestApply(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "mods"), os.ModePerm)
+	os.WriteFile(filepath.Join(dir, "mods", "old.jar"), []byte("old"), 0644)
+
+	plan := Plan{
+		Pack:    "abc",
+		Profile: DefaultProfile,
+		Changes: []Change{{Action: ActionRemove, Kind: TypeMod, Mod: "old", From: "1.0", Old: "mods/old.jar"}},
+		Mods:    []internal.PublicLocalMod{{Slug: "kept", Name: "Kept", Version: "2.0", File: "mods/kept.jar"}},
+	}
+
+	buf := bytes.Buffer{}
+	plan.WriteTable(&buf)
+
+	if !strings.Contains(buf.String(), "remove  mod   old  1.0") || !strings.Contains(buf.String(), "1 to remove, 0 unchanged, 0B to download") {
+		t.Fatalf("unexpected table:\n%s", buf.String())
+	}
+
+	mp := Modpack{instanceDir: dir, profile: DefaultProfile, source: "def"}
+	if err := mp.Apply(context.Background(), plan); !errors.Is(err, errs.ErrIncompatible) {
+		t.Fatalf("expected a plan for another matrix.toml to be refused, but got `%v`", err)
+	}
+
+	mp.source = "abc"
+	if err := mp.Apply(context.Background(), plan); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// nothing's removed until it's committed
+	if _, err := os.Stat(filepath.Join(dir, "mods", "old.jar")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err := mp.Commit(filepath.Join(dir, "matrix.toml")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "mods", "old.jar")); !os.IsNotExist(err) {
+		t.Fatalf("expected old.jar to be removed, but got `%v`", err)
+	}
+
+	if mods := mp.Mods(); len(mods) != 1 || mods[0].File() != "mods/kept.jar" {
+		t.Fatalf("expected the mods from the plan, but got %v", mods)
+	}
+}
+
+func TestFrozenPlan(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "mods"), os.ModePerm)
+	os.WriteFile(filepath.Join(dir, "mods", "a.jar"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(dir, "mods", "b.jar"), []byte("changed"), 0644)
+
+	mods := []internal.PublicLocalMod{
+		{Slug: "a", Name: "A", Version: "1.0", File: "mods/a.jar", Url: "https://example.com/a.jar", Sha1: internal.Sha1([]byte("a"))},
+		{Slug: "b", Name: "B", Version: "1.0", File: "mods/b.jar", Url: "https://example.com/b.jar", Sha1: internal.Sha1([]byte("b"))},
+		{Slug: "c", Name: "C", Version: "1.0", File: "mods/c.jar", Url: "https://example.com/c.jar", Sha1: internal.Sha1([]byte("c"))},
+	}
+
+	mp := Modpack{instanceDir: dir, profile: DefaultProfile}
+	for _, m := range mods {
+		lm, _ := fromPublic(m)
+		mp.mods.mdrth = append(mp.mods.mdrth, lm)
+	}
+
+	plan, err := mp.FrozenPlan()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	actions := []string{}
+	for _, c := range plan.Changes {
+		actions = append(actions, c.Mod+" "+c.Action)
+	}
+
+	if result := strings.Join(actions, ", "); result != "b reinstall, c install" || plan.Unchanged != 1 {
+		t.Fatalf("expected `b reinstall, c install` with 1 unchanged, but got `%s` with %d", result, plan.Unchanged)
+	}
+
+	mp.mods.mdrth = append(mp.mods.mdrth, localmod.NewWithoutVersion("D", "", "", "d", "", ""))
+	if _, err := mp.FrozenPlan(); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("expected a mod that was never synced to fail, but got `%v`", err)
+	}
+}
+
+func TestFrozenForbidden(t *testing.T) {
+	dir := t.TempDir()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	mpv, _ := version.FromString("1.0", ".", 10)
+	mcv, _ := version.FromString("1.21.1", ".", 10)
+
+	r := &recorder{}
+	mp := Modpack{instanceDir: dir, profile: DefaultProfile, name: "a", version: mpv, gameVersion: mcv, modloader: "fabric", observer: r}
+	mp.mods.external = map[string]string{"e.jar": srv.URL + "/e.jar"}
+
+	plan := Plan{Profile: DefaultProfile, Changes: []Change{{Action: ActionInstall, Kind: KindExternal, Mod: "e.jar", Url: srv.URL + "/e.jar", File: "mods/e.jar"}}}
+	if err := mp.Apply(context.Background(), plan); err != nil {
+		t.Fatal(err.Error())
+	} else if err := mp.Commit(filepath.Join(dir, "matrix.toml")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if e, ok := r.events[1].(Failed); !ok || !e.Skipped {
+		t.Fatalf("expected the download to fail and be skipped, but got %v", r.events)
+	}
+
+	mp, err := FromToml(filepath.Join(dir, "matrix.toml"), false, false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// a mod sync couldn't download is skipped, not treated as one that was never synced
+	r = &recorder{}
+	mp.SetObserver(r)
+
+	if plan, err := mp.FrozenPlan(); err != nil {
+		t.Fatal(err.Error())
+	} else if len(plan.Changes) != 0 || len(r.events) != 1 {
+		t.Fatalf("expected e.jar to be skipped, but got %v and %v", plan.Changes, r.events)
+	}
+}
+
+func TestPlanOffline(t *testing.T) {
+	internal.SetOffline(true)
+	defer internal.SetOffline(false)
+
+	mp := Modpack{modloader: "fabric", profile: DefaultProfile}
+	mp.mods.mdrth = []localmod.LocalMod{localmod.NewWithoutVersion("Rubidium", "", "", "rubidium", "", "")}
+
+	// the mod the resolver failed on is looked up again to list what's missing, but it's only listed once
+	_, err := mp.Plan(context.Background())
+	if !errors.Is(err, errs.ErrOffline) {
+		t.Fatalf("expected ErrOffline, but got `%v`", err)
+	} else if err.Error() != "project 'rubidium' isn't cached, so it can't be used offline" {
+		t.Fatalf("expected the missing project once, but got `%s`", err)
+	}
+}
+
+func TestPlanProfiles(t *testing.T) {
+	big, _ := fromPublic(internal.PublicLocalMod{Slug: "big", Profiles: []string{DefaultProfile}})
+
+	mp := Modpack{modloader: "fabric", instanceDir: t.TempDir(), profile: "lite", profiles: []string{DefaultProfile, "lite"}}
+	mp.mods.mdrth = []localmod.LocalMod{big}
+
+	// syncing one profile keeps the mods of the others, even if they've never been synced
+	plan, err := mp.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(plan.Mods) != 1 || plan.Mods[0].Slug != "big" {
+		t.Fatalf("expected 'big' to be kept, but got %v", plan.Mods)
+	}
+}
+
+func TestPlanDuplicates(t *testing.T) {
+	project := remotemod.RemoteMod{Id: "AANobbMI", Slug: "sodium", Title: "Sodium", ProjectType: "mod", GameVersions: []string{"1.21.1"}, Loaders: []string{"fabric"}}
+	versions := []remotemod.RemoteModVersion{{
+		Id: "v1", ProjectId: project.Id, VersionNumber: "0.6.0", GameVersions: []string{"1.21.1"}, Loaders: []string{"fabric"},
+		Files: []remotemod.RemoteModVersionFile{{Filename: "sodium.jar", Url: "https://example.com/sodium.jar", Hashes: map[string]string{"sha1": internal.Sha1([]byte("sodium"))}}},
+	}}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/projects":
+			json.NewEncoder(w).Encode([]remotemod.RemoteMod{project})
+		case strings.HasSuffix(r.URL.Path, "/version"):
+			json.NewEncoder(w).Encode(versions)
+		case strings.HasPrefix(r.URL.Path, "/project/"):
+			json.NewEncoder(w).Encode(project)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	defer func(api string) { remotemod.Api = api }(remotemod.Api)
+	remotemod.Api = srv.URL
+
+	byId := localmod.NewWithoutVersion("", "", project.Id, "", "", "")
+	byId.SetById(true)
+
+	mp := Modpack{modloader: "fabric", instanceDir: t.TempDir(), profile: DefaultProfile}
+	mp.gameVersion, _ = version.FromString("1.21.1", ".", 10)
+	mp.mods.mdrth = []localmod.LocalMod{localmod.NewWithoutVersion("", "", "", "sodium", "", ""), byId}
+
+	// the same mod listed by its slug and its id is only kept once
+	plan, err := mp.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(plan.Mods) != 1 || len(plan.Changes) != 1 {
+		t.Fatalf("expected sodium to be planned once, but got %v and %v", plan.Mods, plan.Changes)
+	}
+}
@@ -0,0 +1,148 @@
+package modpack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/voidwyrm-2/matrix/api/errs"
+	"github.com/voidwyrm-2/matrix/api/localmod"
+	"github.com/voidwyrm-2/matrix/api/matrixfile"
+	"github.com/voidwyrm-2/matrix/api/remotemod"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// compares the result against the golden file, or rewrites it with -update
+func golden(t *testing.T, name string, result []byte) {
+	t.Helper()
+
+	if *update {
+		if err := os.WriteFile(name, result, 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		return
+	}
+
+	expect, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if !bytes.Equal(expect, result) {
+		t.Fatalf("%s doesn't match, got:\n%s", name, result)
+	}
+}
+
+// fills in what a sync would without downloading anything
+func fakeSync(t *testing.T) {
+	t.Helper()
+
+	mp, err := FromToml("matrix.toml", false, false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for i := range mp.mods.mdrth {
+		m := mp.mods.mdrth[i].Active()
+
+		remote := remotemod.RemoteMod{Id: "id-" + m.GetIdOrSlug(), Slug: m.GetIdOrSlug(), Title: m.GetIdOrSlug()}
+		if m.ById() {
+			remote.Id, remote.Slug = m.GetIdOrSlug(), "slug-"+m.GetIdOrSlug()
+		}
+
+		m.Apply(remote, remotemod.RemoteModVersion{VersionNumber: "1.0.0"})
+	}
+
+	dep := localmod.NewDependency("dependency", "")
+	dep.Apply(remotemod.RemoteMod{Id: "dependency", Slug: "dependency", Title: "Dependency"}, remotemod.RemoteModVersion{VersionNumber: "2.0.0"})
+	mp.mods.mdrth = append(mp.mods.mdrth, dep)
+
+	if err := mp.ToToml("matrix.toml"); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	cases, err := filepath.Glob("testdata/roundtrip/*")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+
+	for _, c := range cases {
+		c = filepath.Join(wd, c)
+		dir := t.TempDir()
+
+		files, _ := os.ReadDir(c)
+		for _, f := range files {
+			if content, err := os.ReadFile(filepath.Join(c, f.Name())); err != nil {
+				t.Fatal(err.Error())
+			} else if !strings.HasSuffix(f.Name(), ".golden") {
+				os.WriteFile(filepath.Join(dir, f.Name()), content, 0644)
+			}
+		}
+
+		os.Chdir(dir)
+
+		if err := FromMatrixfile(context.Background(), "matrix.toml", "", "", "", ""); err != nil {
+			t.Fatalf("%s: %s", c, err.Error())
+		}
+
+		made, _ := os.ReadFile("matrix.toml")
+		golden(t, filepath.Join(c, "make.golden"), made)
+
+		fakeSync(t)
+
+		mp, err := FromToml("matrix.toml", false, false)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		// syncing doesn't make the matrix.toml disagree with the Matrixfile
+		if err := mp.CheckMatrixfile(context.Background(), ""); err != nil {
+			t.Fatalf("%s: %s", c, err.Error())
+		}
+
+		gen := mp.ToMatrixfile()
+		golden(t, filepath.Join(c, "demake.golden"), gen.Format(false))
+
+		// the original is kept as it is when nothing changed
+		original, _, err := matrixfile.Open("")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		target := matrixfile.Target{Loader: mp.Modloader(), GameVersion: mp.GameVersion()}
+		if merged := original.Merge(gen, target).Bytes(); !bytes.Equal(merged, original.Bytes()) {
+			t.Fatalf("%s: expected demake to keep the Matrixfile as it is, but got:\n%s", c, merged)
+		}
+
+		mp.mods.mdrth = append(mp.mods.mdrth[1:], localmod.NewWithoutVersion("", "", "", "added", "", ""))
+		if err := mp.CheckMatrixfile(context.Background(), ""); !errors.Is(err, errs.ErrIncompatible) {
+			t.Fatalf("%s: expected the changed mods to disagree with the Matrixfile, but got `%v`", c, err)
+		}
+
+		golden(t, filepath.Join(c, "merge.golden"), original.Merge(mp.ToMatrixfile(), target).Bytes())
+
+		// and making the demade Matrixfile gives back the same matrix.toml
+		os.Remove(original.Path)
+		os.WriteFile("Matrixfile", gen.Format(false), 0644)
+
+		if err := FromMatrixfile(context.Background(), "matrix.toml", "", "", "", ""); err != nil {
+			t.Fatalf("%s: %s", c, err.Error())
+		}
+
+		if remade, _ := os.ReadFile("matrix.toml"); !bytes.Equal(made, remade) {
+			t.Fatalf("%s: the demade Matrixfile made a different matrix.toml:\n%s", c, remade)
+		}
+
+		os.Chdir(wd)
+	}
+}
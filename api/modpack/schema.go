@@ -0,0 +1,134 @@
+package modpack
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/voidwyrm-2/matrix/api/errs"
+	"github.com/voidwyrm-2/matrix/api/internal"
+	"github.com/voidwyrm-2/matrix/api/matrixfile"
+)
+
+// the schema of the matrix.toml files this version writes, which has to be bumped with a new migration whenever the shape of internal.PublicModpack changes
+const Schema = 2
+
+// migrations[n] upgrades a document from schema n to schema n+1, name being where it was read from.
+// They work on the raw document rather than internal.PublicModpack, since the old shape might not fit in it anymore
+var migrations = []func(doc map[string]any, name string) error{
+	// files from before the schema was recorded didn't always have the modloader, so it's taken from the Matrixfile next to it if there is one
+	func(doc map[string]any, name string) error {
+		if loader, _ := lookup(doc, "Modloader").(string); loader != "" {
+			return nil
+		}
+
+		f, _, err := matrixfile.Open(filepath.Dir(name))
+		if err != nil {
+			return fmt.Errorf("matrix.toml doesn't have a modloader and it couldn't be taken from the Matrixfile: %s", strings.TrimSpace(err.Error()))
+		}
+
+		doc["Modloader"] = f.Header.Loader
+
+		return nil
+	},
+	// schema 2 records what each sync downloaded (each mod's File, VersionId, Url and Sha1, and ExternalHashes),
+	// which older files just don't have until they're synced again
+	func(doc map[string]any, name string) error {
+		return nil
+	},
+}
+
+// finds a key the way the toml decoder does, ignoring its case
+func lookup(doc map[string]any, key string) any {
+	for k, v := range doc {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// upgrades a document to the current schema, returning the schema it had
+func migrate(doc map[string]any, name string) (int, error) {
+	from := 0
+	if schema, ok := lookup(doc, "schema").(int64); ok {
+		from = int(schema)
+	} else if lookup(doc, "schema") != nil {
+		return 0, errs.Errorf(errs.ErrParse, "the schema of matrix.toml should be a number")
+	}
+
+	if from > Schema {
+		return from, errs.Errorf(errs.ErrIncompatible, "matrix.toml uses schema %d, but this version of matrix only knows up to %d, try updating matrix", from, Schema)
+	} else if from < 0 {
+		return from, errs.Errorf(errs.ErrParse, "invalid schema %d in matrix.toml", from)
+	}
+
+	for k := range doc {
+		if strings.EqualFold(k, "schema") {
+			delete(doc, k)
+		}
+	}
+
+	for i := from; i < Schema; i++ {
+		if err := migrations[i](doc, name); err != nil {
+			return from, err
+		}
+	}
+
+	doc["schema"] = int64(Schema)
+
+	return from, nil
+}
+
+// reads a matrix.toml, upgrading it to the current schema if it's older
+func readToml(name string) (internal.PublicModpack, int, error) {
+	st := internal.PublicModpack{}
+
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return st, 0, err
+	}
+
+	doc := map[string]any{}
+	if _, err := toml.Decode(string(content), &doc); err != nil {
+		return st, 0, errs.Toml(name, err)
+	}
+
+	from, err := migrate(doc, name)
+	if err != nil {
+		return st, from, err
+	} else if from == Schema {
+		_, err = toml.Decode(string(content), &st)
+		return st, from, err
+	}
+
+	buf := bytes.Buffer{}
+	if err := toml.NewEncoder(&buf).Encode(doc); err != nil {
+		return st, from, err
+	}
+
+	_, err = toml.Decode(buf.String(), &st)
+
+	return st, from, err
+}
+
+// rewrites a matrix.toml in the current schema, returning the schema it had
+func Migrate(name string) (int, error) {
+	st, from, err := readToml(name)
+	if err != nil || from == Schema {
+		return from, err
+	}
+
+	st.Schema = Schema
+
+	result, err := toml.Marshal(st)
+	if err != nil {
+		return from, err
+	}
+
+	return from, internal.WriteFile(name, result)
+}
@@ -0,0 +1,108 @@
+package modpack
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/voidwyrm-2/matrix/api/internal"
+)
+
+func TestMigrate(t *testing.T) {
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+
+	os.Chdir(t.TempDir())
+	os.WriteFile("Matrixfile", []byte("Old Pack\n1.0.0\n1.20.1\nfabric\n\nsodium\n"), 0644)
+
+	cases := []struct {
+		content, err string
+		from         int
+	}{
+		{"Name = \"Old Pack\"\nModpackVersion = \"1.0.0\"\nGameVersion = \"1.20.1\"\n[Mods]\n[[Mods.Mdrth]]\nSlug = \"sodium\"\n", "", 0},
+		{"schema = 1\nName = \"Old Pack\"\nModpackVersion = \"1.0.0\"\nGameVersion = \"1.20.1\"\nModloader = \"fabric\"\n[Mods]\n[[Mods.Mdrth]]\nSlug = \"sodium\"\n", "", 1},
+		{"schema = 2\nName = \"Old Pack\"\nModpackVersion = \"1.0.0\"\nGameVersion = \"1.20.1\"\nModloader = \"quilt\"\n", "", 2},
+		{"schema = 99\nName = \"New Pack\"\n", "matrix.toml uses schema 99, but this version of matrix only knows up to 2, try updating matrix", 99},
+		{"schema = \"1\"\n", "the schema of matrix.toml should be a number", 0},
+	}
+
+	for _, c := range cases {
+		os.WriteFile("matrix.toml", []byte(c.content), 0644)
+
+		from, err := Migrate("matrix.toml")
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Fatalf("expected error '%s', but got '%v'", c.err, err)
+			}
+
+			continue
+		} else if err != nil {
+			t.Fatal(err.Error())
+		} else if from != c.from {
+			t.Fatalf("expected the file to be on schema %d, but it was on %d", c.from, from)
+		}
+
+		st, from, err := readToml("matrix.toml")
+		if err != nil {
+			t.Fatal(err.Error())
+		} else if from != Schema || st.Schema != Schema {
+			t.Fatalf("expected the file to be rewritten on schema %d, but it's on %d", Schema, from)
+		} else if c.from < Schema && (st.Modloader != "fabric" || len(st.Mods.Mdrth) != 1) {
+			t.Fatalf("expected the modloader to come from the Matrixfile and the mods to be kept, but got %+v", st)
+		} else if c.from == Schema && st.Modloader != "quilt" {
+			t.Fatalf("expected a current file to be left alone, but got %+v", st)
+		}
+	}
+}
+
+// the published JSON Schema has to know about every field that can be written
+func TestJsonSchema(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("..", "..", "docs", "matrix.schema.json"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	schema := struct {
+		Properties map[string]struct {
+			Const      *int
+			Properties map[string]any
+		}
+		Defs map[string]struct {
+			Properties map[string]any
+		} `json:"$defs"`
+	}{}
+
+	if err := json.Unmarshal(content, &schema); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if c := schema.Properties["schema"].Const; c == nil || *c != Schema {
+		t.Fatalf("expected the JSON Schema to be for schema %d", Schema)
+	}
+
+	check := func(typ reflect.Type, properties map[string]any) {
+		for i := 0; i < typ.NumField(); i++ {
+			name := typ.Field(i).Name
+			if tag, _, _ := strings.Cut(typ.Field(i).Tag.Get("toml"), ","); tag != "" {
+				name = tag
+			}
+
+			if _, ok := properties[name]; !ok {
+				t.Fatalf("the JSON Schema is missing '%s' in %s", name, typ)
+			}
+		}
+	}
+
+	top := map[string]any{}
+	for k := range schema.Properties {
+		top[k] = nil
+	}
+
+	check(reflect.TypeOf(internal.PublicModpack{}), top)
+	check(reflect.TypeOf(internal.PublicOverrides{}), schema.Properties["Overrides"].Properties)
+	check(reflect.TypeOf(internal.PublicModpack{}.Mods), schema.Properties["Mods"].Properties)
+	check(reflect.TypeOf(internal.PublicLocalMod{}), schema.Defs["mod"].Properties)
+}
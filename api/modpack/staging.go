@@ -0,0 +1,223 @@
+package modpack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/voidwyrm-2/matrix/api/internal"
+)
+
+// where files are kept until they're moved into the instance, relative to it
+var StagingDir = filepath.Join(".matrix", "staging")
+
+type stagedFile struct {
+	// where it's kept until it's committed, empty if the target is being removed, and where it goes
+	staged, target string
+}
+
+// the files a sync writes, which are downloaded into a folder next to the instance and only moved into it
+// once everything has been downloaded, so a sync that fails or is cancelled leaves the instance how it was
+type stage struct {
+	mu    sync.Mutex
+	dir   string
+	files []stagedFile
+}
+
+// a new folder to stage files in; it's on the same filesystem as the instance so moving the files is just renaming them
+func newStage(instanceDir string) (*stage, error) {
+	parent := filepath.Join(instanceDir, StagingDir)
+	if err := os.MkdirAll(parent, os.ModeDir|os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(parent, "sync-*")
+	if err != nil {
+		return nil, err
+	}
+
+	return &stage{dir: dir}, nil
+}
+
+// stages a file to be written to target, replacing whatever's staged for it already
+func (s *stage) write(target string, content []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.files, func(f stagedFile) bool { return f.target == target })
+	if i == -1 {
+		i = len(s.files)
+		s.files = append(s.files, stagedFile{target: target})
+	}
+
+	// a file that was going to be removed gets somewhere to be kept instead
+	if s.files[i].staged == "" {
+		s.files[i].staged = filepath.Join(s.dir, fmt.Sprint(i))
+	}
+
+	return internal.WriteFile(s.files[i].staged, content)
+}
+
+// stages a file to be removed, replacing whatever's staged for it already
+func (s *stage) delete(target string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := slices.IndexFunc(s.files, func(f stagedFile) bool { return f.target == target }); i != -1 {
+		os.Remove(s.files[i].staged)
+		s.files[i].staged = ""
+		return
+	}
+
+	s.files = append(s.files, stagedFile{target: target})
+}
+
+// moves every staged file into place, putting back the files it replaced if any of them can't be moved;
+// the files it replaced are kept until the stage is cleared, so what it did can be undone with the returned func
+func (s *stage) commit() (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the files that have been moved, and where the file they replaced was moved to, if there was one
+	type swap struct {
+		target, backup string
+	}
+
+	done := []swap{}
+
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			os.Remove(done[i].target)
+			if done[i].backup != "" {
+				os.Rename(done[i].backup, done[i].target)
+			}
+		}
+	}
+
+	for i, f := range s.files {
+		if f.staged == "" {
+			if _, err := os.Lstat(f.target); err != nil {
+				continue
+			}
+
+			backup := filepath.Join(s.dir, fmt.Sprintf("%d.old", i))
+			if err := os.Rename(f.target, backup); err != nil {
+				rollback()
+				return nil, err
+			}
+
+			done = append(done, swap{target: f.target, backup: backup})
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(f.target), os.ModeDir|os.ModePerm); err != nil {
+			rollback()
+			return nil, err
+		}
+
+		backup := ""
+		if _, err := os.Lstat(f.target); err == nil {
+			backup = filepath.Join(s.dir, fmt.Sprintf("%d.old", i))
+			if err := os.Rename(f.target, backup); err != nil {
+				rollback()
+				return nil, err
+			}
+		}
+
+		if err := os.Rename(f.staged, f.target); err != nil {
+			if backup != "" {
+				os.Rename(backup, f.target)
+			}
+
+			rollback()
+			return nil, err
+		}
+
+		done = append(done, swap{target: f.target, backup: backup})
+	}
+
+	return rollback, nil
+}
+
+func (s *stage) clear() error {
+	if err := os.RemoveAll(s.dir); err != nil {
+		return err
+	}
+
+	// only removed if no other sync is using it
+	os.Remove(filepath.Dir(s.dir))
+
+	return nil
+}
+
+// the stage, which is created the first time something is staged
+func (mp *Modpack) staged() (*stage, error) {
+	if mp.stage == nil {
+		s, err := newStage(mp.instanceDir)
+		if err != nil {
+			return nil, err
+		}
+
+		mp.stage = s
+	}
+
+	return mp.stage, nil
+}
+
+// stages a file for the instance
+func (mp *Modpack) write(target string, content []byte) error {
+	s, err := mp.staged()
+	if err != nil {
+		return err
+	}
+
+	return s.write(target, content)
+}
+
+// stages a file of the instance to be removed
+func (mp *Modpack) remove(target string) error {
+	s, err := mp.staged()
+	if err != nil {
+		return err
+	}
+
+	s.delete(target)
+
+	return nil
+}
+
+// moves the files that were staged by ApplyOverrides and Apply into the instance and writes the pack to name,
+// all together; if any of it fails, everything is put back how it was
+func (mp *Modpack) Commit(name string) error {
+	defer mp.Discard()
+
+	content, err := mp.toToml()
+	if err != nil {
+		return err
+	}
+
+	rollback := func() {}
+	if mp.stage != nil {
+		if rollback, err = mp.stage.commit(); err != nil {
+			return err
+		}
+	}
+
+	// the pack file can be on a different filesystem than the instance, so it's swapped on its own
+	// with a temporary file next to it, after everything else is in place
+	if err = internal.WriteFile(name, content); err != nil {
+		rollback()
+	}
+
+	return err
+}
+
+// throws away the files that were staged, leaving the instance how it was
+func (mp *Modpack) Discard() {
+	if mp.stage != nil {
+		mp.stage.clear()
+		mp.stage = nil
+	}
+}
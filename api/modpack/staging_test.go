@@ -0,0 +1,116 @@
+package modpack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStage(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "mods"), os.ModePerm)
+	os.WriteFile(filepath.Join(dir, "mods", "old.jar"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(dir, "matrix.toml"), []byte("old"), 0644)
+
+	mp := Modpack{instanceDir: dir}
+	mp.write(filepath.Join(dir, "mods", "old.jar"), []byte("new"))
+	mp.write(filepath.Join(dir, "mods", "added.jar"), []byte("added"))
+
+	// nothing changes until it's committed
+	if content, _ := os.ReadFile(filepath.Join(dir, "mods", "old.jar")); string(content) != "old" {
+		t.Fatalf("expected the staged file not to be written yet, but got `%s`", content)
+	}
+
+	if err := mp.Commit(filepath.Join(dir, "matrix.toml")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for name, expect := range map[string]string{"mods/old.jar": "new", "mods/added.jar": "added"} {
+		if content, _ := os.ReadFile(filepath.Join(dir, name)); string(content) != expect {
+			t.Fatalf("expected %s to be `%s`, but got `%s`", name, expect, content)
+		}
+	}
+
+	if entries, _ := os.ReadDir(filepath.Join(dir, StagingDir)); len(entries) != 0 {
+		t.Fatalf("expected the stage to be removed, but found %v", entries)
+	}
+
+	toml, _ := os.ReadFile(filepath.Join(dir, "matrix.toml"))
+
+	// a file that can't be moved into place puts back everything that was
+	mp.write(filepath.Join(dir, "mods", "old.jar"), []byte("newer"))
+	os.MkdirAll(filepath.Join(dir, "blocked"), os.ModePerm)
+	os.WriteFile(filepath.Join(dir, "blocked", "file"), []byte{}, 0644)
+	mp.write(filepath.Join(dir, "blocked", "file", "mod.jar"), []byte("mod"))
+
+	if err := mp.Commit(filepath.Join(dir, "matrix.toml")); err == nil {
+		t.Fatal("expected committing to fail")
+	}
+
+	if content, _ := os.ReadFile(filepath.Join(dir, "mods", "old.jar")); string(content) != "new" {
+		t.Fatalf("expected old.jar to be rolled back, but got `%s`", content)
+	}
+
+	if content, _ := os.ReadFile(filepath.Join(dir, "matrix.toml")); string(content) != string(toml) {
+		t.Fatalf("expected the matrix.toml not to change, but got `%s`", content)
+	}
+}
+
+func TestStageOutsidePack(t *testing.T) {
+	dir, packDir := t.TempDir(), t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "mods"), os.ModePerm)
+	os.WriteFile(filepath.Join(dir, "mods", "old.jar"), []byte("old"), 0644)
+
+	// the instance can be on a different filesystem than the pack file, so the pack file isn't moved through the stage
+	mp := Modpack{instanceDir: dir}
+	mp.write(filepath.Join(dir, "mods", "old.jar"), []byte("new"))
+
+	if err := mp.Commit(filepath.Join(packDir, "matrix.toml")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if content, _ := os.ReadFile(filepath.Join(dir, "mods", "old.jar")); string(content) != "new" {
+		t.Fatalf("expected old.jar to be `new`, but got `%s`", content)
+	} else if _, err := os.Stat(filepath.Join(packDir, "matrix.toml")); err != nil {
+		t.Fatalf("expected the matrix.toml to be written, but got %s", err)
+	}
+
+	// a pack file that can't be written puts back the instance's files
+	mp.write(filepath.Join(dir, "mods", "old.jar"), []byte("newer"))
+
+	if err := mp.Commit(filepath.Join(packDir, "missing", "matrix.toml")); err == nil {
+		t.Fatal("expected committing to fail")
+	}
+
+	if content, _ := os.ReadFile(filepath.Join(dir, "mods", "old.jar")); string(content) != "new" {
+		t.Fatalf("expected old.jar to be rolled back, but got `%s`", content)
+	}
+
+	if entries, _ := os.ReadDir(filepath.Join(dir, StagingDir)); len(entries) != 0 {
+		t.Fatalf("expected the stage to be removed, but found %v", entries)
+	}
+}
+
+func TestStageReplaced(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "mods"), os.ModePerm)
+	os.WriteFile(filepath.Join(dir, "mods", "a.jar"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(dir, "mods", "b.jar"), []byte("old"), 0644)
+
+	// whatever was staged last for a file is what happens to it
+	mp := Modpack{instanceDir: dir}
+	mp.remove(filepath.Join(dir, "mods", "a.jar"))
+	mp.write(filepath.Join(dir, "mods", "a.jar"), []byte("new"))
+	mp.write(filepath.Join(dir, "mods", "b.jar"), []byte("new"))
+	mp.remove(filepath.Join(dir, "mods", "b.jar"))
+
+	if err := mp.Commit(filepath.Join(dir, "matrix.toml")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if content, _ := os.ReadFile(filepath.Join(dir, "mods", "a.jar")); string(content) != "new" {
+		t.Fatalf("expected a.jar to be `new`, but got `%s`", content)
+	} else if _, err := os.Stat(filepath.Join(dir, "mods", "b.jar")); !os.IsNotExist(err) {
+		t.Fatalf("expected b.jar to be removed, but got %v", err)
+	}
+}
@@ -1,13 +1,35 @@
 package remotemod
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
+	"slices"
 	"strings"
+	"sync"
 
+	"github.com/voidwyrm-2/matrix/api/errs"
 	"github.com/voidwyrm-2/matrix/api/internal"
 )
 
+// the Modrinth API, which can be changed to use a mirror
+var Api = "https://api.modrinth.com/v2"
+
+// the release channels versions are published on, from most to least stable
+var Channels = []string{"release", "beta", "alpha"}
+
+// whether a version is at least as stable as the channel, versions without one count as releases
+func (rmv RemoteModVersion) OnChannel(channel string) bool {
+	kind := rmv.VersionType
+	if kind == "" {
+		kind = Channels[0]
+	}
+
+	return slices.Index(Channels, kind) <= slices.Index(Channels, channel)
+}
+
 type RemoteModVersionDependency struct {
 	VersionId string `json:"version_id"`
 	ProjectId string `json:"project_id"`
@@ -21,6 +43,9 @@ func (rmvd RemoteModVersionDependency) String() string {
 
 type RemoteModVersionFile struct {
 	Filename, Url string
+	// the file's hashes by algorithm, e.g. "sha1"
+	Hashes map[string]string
+	Size   int64
 }
 
 func (rmvf RemoteModVersionFile) String() string {
@@ -29,7 +54,10 @@ func (rmvf RemoteModVersionFile) String() string {
 
 type RemoteModVersion struct {
 	Id            string
+	ProjectId     string   `json:"project_id"`
 	VersionNumber string   `json:"version_number"`
+	VersionType   string   `json:"version_type"`
+	DatePublished string   `json:"date_published"`
 	GameVersions  []string `json:"game_versions"`
 	Loaders       []string
 	Dependencies  []RemoteModVersionDependency
@@ -52,36 +80,351 @@ func (rmv RemoteModVersion) String() string {
 
 type RemoteMod struct {
 	Id, Slug, Title, Description string
+	ProjectType                  string   `json:"project_type"`
 	GameVersions                 []string `json:"game_versions"`
 	Categories, Loaders          []string
 	Versions                     []RemoteModVersion `json:"-"`
 }
 
-func FromProject(idOrSlug string) (RemoteMod, error) {
+// how many ids are asked for in one request, so the url doesn't get too long
+const batchSize = 100
+
+// what's been looked up during a run, so nothing is requested twice
+type memo struct {
+	sync.Mutex
+	// by id and by slug, without their versions
+	projects map[string]RemoteMod
+	versions map[string]RemoteModVersion
+	// a project's versions by the url they were requested with
+	lists map[string][]RemoteModVersion
+}
+
+type memoKey struct{}
+
+// a context that remembers everything that's looked up with it, so a run doesn't request anything twice
+// but the next one still sees what changed on Modrinth since
+func WithMemo(ctx context.Context) context.Context {
+	return context.WithValue(ctx, memoKey{}, &memo{projects: map[string]RemoteMod{}, versions: map[string]RemoteModVersion{}, lists: map[string][]RemoteModVersion{}})
+}
+
+// the context's memo, or one that's thrown away afterwards if it doesn't have one
+func memoFrom(ctx context.Context) *memo {
+	if mem, ok := ctx.Value(memoKey{}).(*memo); ok {
+		return mem
+	}
+
+	return memoFrom(WithMemo(ctx))
+}
+
+func (mem *memo) rememberProject(raw []byte) (RemoteMod, error) {
 	mod := RemoteMod{}
+	if err := json.Unmarshal(raw, &mod); err != nil {
+		return RemoteMod{}, err
+	}
+
+	mem.Lock()
+	mem.projects[mod.Id], mem.projects[mod.Slug] = mod, mod
+	mem.Unlock()
+
+	return mod, nil
+}
+
+func (mem *memo) rememberVersion(raw []byte) (RemoteModVersion, error) {
+	v := RemoteModVersion{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return RemoteModVersion{}, err
+	}
+
+	mem.Lock()
+	mem.versions[v.Id] = v
+	mem.Unlock()
+
+	return v, nil
+}
+
+// a list as a query parameter, which Modrinth wants as a JSON array
+func jsonParam(values []string) string {
+	content, _ := json.Marshal(values)
+	return url.QueryEscape(string(content))
+}
+
+// splits the ids that haven't been looked up yet into batches, leaving out duplicates
+func batches(ids []string, known map[string]bool) [][]string {
+	todo := []string{}
+	for _, id := range ids {
+		if id != "" && !known[id] {
+			known[id] = true
+			todo = append(todo, id)
+		}
+	}
+
+	result := [][]string{}
+	for len(todo) > 0 {
+		n := min(len(todo), batchSize)
+		result = append(result, todo[:n])
+		todo = todo[n:]
+	}
+
+	return result
+}
+
+func FromVersion(ctx context.Context, id string) (RemoteModVersion, error) {
+	mem := memoFrom(ctx)
+	mem.Lock()
+	v, ok := mem.versions[id]
+	mem.Unlock()
+
+	if ok {
+		return v, nil
+	}
+
+	resp, err := internal.Get(ctx, Api+"/version/"+id)
+	if errors.Is(err, errs.ErrOffline) {
+		return RemoteModVersion{}, &errs.MissingError{What: fmt.Sprintf("version '%s'", id)}
+	} else if err != nil {
+		return RemoteModVersion{}, err
+	}
+
+	return mem.rememberVersion(resp)
+}
+
+// looks up the versions by id in as few requests as possible, leaving out the ones that don't exist
+func Versions(ctx context.Context, ids []string) ([]RemoteModVersion, error) {
+	mem := memoFrom(ctx)
+	mem.Lock()
+	known := map[string]bool{}
+	for id := range mem.versions {
+		known[id] = true
+	}
+	mem.Unlock()
+
+	for _, batch := range batches(ids, known) {
+		resp, err := internal.Get(ctx, Api+"/versions?ids="+jsonParam(batch))
+		if err != nil {
+			return nil, err
+		}
+
+		raws := []json.RawMessage{}
+		if err = json.Unmarshal(resp, &raws); err != nil {
+			return nil, err
+		}
+
+		for _, raw := range raws {
+			v, err := mem.rememberVersion(raw)
+			if err != nil {
+				return nil, err
+			}
+
+			// so it can still be looked up on its own offline
+			internal.Remember(Api+"/version/"+v.Id, raw)
+		}
+	}
+
+	mem.Lock()
+	defer mem.Unlock()
+
 	versions := []RemoteModVersion{}
+	for _, id := range ids {
+		if v, ok := mem.versions[id]; ok {
+			versions = append(versions, v)
+		}
+	}
+
+	return versions, nil
+}
+
+// looks up the versions files with these sha1 hashes belong to, by hash, leaving out the ones Modrinth doesn't know
+func FromHashes(ctx context.Context, hashes []string) (map[string]RemoteModVersion, error) {
+	mem := memoFrom(ctx)
+
+	versions := map[string]RemoteModVersion{}
+	if len(hashes) == 0 {
+		return versions, nil
+	}
 
-	modResp, err := internal.Download("https://api.modrinth.com/v2/project/" + idOrSlug)
+	body, err := json.Marshal(struct {
+		Hashes    []string `json:"hashes"`
+		Algorithm string   `json:"algorithm"`
+	}{hashes, "sha1"})
 	if err != nil {
-		return RemoteMod{}, err
+		return nil, err
 	}
 
-	err = json.Unmarshal(modResp, &mod)
+	resp, err := internal.Post(ctx, Api+"/version_files", body)
 	if err != nil {
+		return nil, err
+	}
+
+	raws := map[string]json.RawMessage{}
+	if err = json.Unmarshal(resp, &raws); err != nil {
+		return nil, err
+	}
+
+	for hash, raw := range raws {
+		v, err := mem.rememberVersion(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		internal.Remember(Api+"/version/"+v.Id, raw)
+		versions[hash] = v
+	}
+
+	return versions, nil
+}
+
+// the project without its versions
+func Project(ctx context.Context, idOrSlug string) (RemoteMod, error) {
+	mem := memoFrom(ctx)
+	mem.Lock()
+	mod, ok := mem.projects[idOrSlug]
+	mem.Unlock()
+
+	if ok {
+		return mod, nil
+	}
+
+	resp, err := internal.Get(ctx, Api+"/project/"+idOrSlug)
+	if errors.Is(err, errs.ErrOffline) {
+		return RemoteMod{}, &errs.MissingError{What: fmt.Sprintf("project '%s'", idOrSlug)}
+	} else if err != nil {
 		return RemoteMod{}, err
 	}
 
-	versionsResp, err := internal.Download("https://api.modrinth.com/v2/project/" + idOrSlug + "/version")
+	return mem.rememberProject(resp)
+}
+
+// looks up the projects by id or slug in as few requests as possible, without their versions,
+// leaving out the ones that don't exist
+func Projects(ctx context.Context, idsOrSlugs []string) ([]RemoteMod, error) {
+	mem := memoFrom(ctx)
+	mem.Lock()
+	known := map[string]bool{}
+	for id := range mem.projects {
+		known[id] = true
+	}
+	mem.Unlock()
+
+	for _, batch := range batches(idsOrSlugs, known) {
+		resp, err := internal.Get(ctx, Api+"/projects?ids="+jsonParam(batch))
+		if err != nil {
+			return nil, err
+		}
+
+		raws := []json.RawMessage{}
+		if err = json.Unmarshal(resp, &raws); err != nil {
+			return nil, err
+		}
+
+		for _, raw := range raws {
+			mod, err := mem.rememberProject(raw)
+			if err != nil {
+				return nil, err
+			}
+
+			// so it can still be looked up on its own offline
+			internal.Remember(Api+"/project/"+mod.Id, raw)
+			internal.Remember(Api+"/project/"+mod.Slug, raw)
+		}
+	}
+
+	mem.Lock()
+	defer mem.Unlock()
+
+	mods := []RemoteMod{}
+	for _, idOrSlug := range idsOrSlugs {
+		if mod, ok := mem.projects[idOrSlug]; ok {
+			mods = append(mods, mod)
+		}
+	}
+
+	return mods, nil
+}
+
+// the project's versions for the game version and any of the loaders, which Modrinth filters,
+// or every version it has if gameVersion is empty and there are no loaders
+func ProjectVersions(ctx context.Context, idOrSlug, gameVersion string, loaders ...string) ([]RemoteModVersion, error) {
+	mem := memoFrom(ctx)
+
+	query := []string{}
+	if len(loaders) > 0 {
+		query = append(query, "loaders="+jsonParam(loaders))
+	}
+
+	if gameVersion != "" {
+		query = append(query, "game_versions="+jsonParam([]string{gameVersion}))
+	}
+
+	u := Api + "/project/" + idOrSlug + "/version"
+	if len(query) > 0 {
+		u += "?" + strings.Join(query, "&")
+	}
+
+	mem.Lock()
+	versions, ok := mem.lists[u]
+	mem.Unlock()
+
+	if ok {
+		return slices.Clone(versions), nil
+	}
+
+	resp, err := internal.Get(ctx, u)
+	if errors.Is(err, errs.ErrOffline) {
+		return nil, &errs.MissingError{What: fmt.Sprintf("the versions of '%s'", idOrSlug)}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(resp, &versions); err != nil {
+		return nil, err
+	}
+
+	mem.Lock()
+	mem.lists[u] = versions
+	for _, v := range versions {
+		mem.versions[v.Id] = v
+	}
+	mem.Unlock()
+
+	return versions, nil
+}
+
+// the project with its versions for the game version and any of the loaders, see ProjectVersions
+func FromProject(ctx context.Context, idOrSlug, gameVersion string, loaders ...string) (RemoteMod, error) {
+	mod, err := Project(ctx, idOrSlug)
 	if err != nil {
 		return RemoteMod{}, err
 	}
 
-	err = json.Unmarshal(versionsResp, &versions)
+	mod.Versions, err = ProjectVersions(ctx, mod.Id, gameVersion, loaders...)
 	if err != nil {
 		return RemoteMod{}, err
 	}
 
-	mod.Versions = versions
-
 	return mod, nil
 }
+
+type SearchHit struct {
+	ProjectId   string `json:"project_id"`
+	Slug, Title string
+	ProjectType string `json:"project_type"`
+}
+
+// searches Modrinth for projects matching the query, best match first
+func Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	result := struct {
+		Hits []SearchHit
+	}{}
+
+	resp, err := internal.Get(ctx, fmt.Sprintf("%s/search?query=%s&limit=%d", Api, url.QueryEscape(query), limit))
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Hits, nil
+}
@@ -0,0 +1,109 @@
+package remotemod
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestBulk(t *testing.T) {
+	requests := []string{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		switch r.URL.Path {
+		case "/projects":
+			ids := []string{}
+			json.Unmarshal([]byte(r.URL.Query().Get("ids")), &ids)
+
+			projects := []RemoteMod{}
+			for _, id := range ids {
+				if id != "missing" {
+					projects = append(projects, RemoteMod{Id: "id-" + id, Slug: id})
+				}
+			}
+
+			json.NewEncoder(w).Encode(projects)
+		case "/project/id-sodium/version":
+			loaders, gameVersions := []string{}, []string{}
+			json.Unmarshal([]byte(r.URL.Query().Get("loaders")), &loaders)
+			json.Unmarshal([]byte(r.URL.Query().Get("game_versions")), &gameVersions)
+
+			if !slices.Equal(loaders, []string{"fabric", "quilt"}) || !slices.Equal(gameVersions, []string{"1.21.1"}) {
+				t.Errorf("expected the versions to be filtered by Modrinth, but got loaders %v and game versions %v", loaders, gameVersions)
+			}
+
+			json.NewEncoder(w).Encode([]RemoteModVersion{{Id: "v1", ProjectId: "id-sodium"}})
+		case "/version_files":
+			body := struct{ Hashes []string }{}
+			content, _ := io.ReadAll(r.Body)
+			json.Unmarshal(content, &body)
+
+			json.NewEncoder(w).Encode(map[string]RemoteModVersion{body.Hashes[0]: {Id: "v0", ProjectId: "id-lithium"}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	defer func(api string) { Api = api }(Api)
+	Api = srv.URL
+
+	ctx := WithMemo(context.Background())
+
+	mods, err := Projects(ctx, []string{"sodium", "lithium", "sodium", "missing"})
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if len(mods) != 3 {
+		t.Fatalf("expected sodium twice and lithium, but got %v", mods)
+	}
+
+	// already looked up, so none of these make a request
+	for _, idOrSlug := range []string{"sodium", "id-sodium", "lithium"} {
+		if _, err := Project(ctx, idOrSlug); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	if _, err := Projects(ctx, []string{"id-lithium"}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for i := 0; i < 2; i++ {
+		mod, err := FromProject(ctx, "sodium", "1.21.1", "fabric", "quilt")
+		if err != nil {
+			t.Fatal(err.Error())
+		} else if len(mod.Versions) != 1 {
+			t.Fatalf("expected 1 version, but got %v", mod.Versions)
+		}
+	}
+
+	if versions, err := FromHashes(ctx, []string{"abc"}); err != nil {
+		t.Fatal(err.Error())
+	} else if versions["abc"].Id != "v0" {
+		t.Fatalf("expected the hash to be version v0, but got %v", versions)
+	}
+
+	for _, id := range []string{"v0", "v1"} {
+		if _, err := FromVersion(ctx, id); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	expected := []string{"GET /projects", "GET /project/id-sodium/version", "POST /version_files"}
+	if !slices.Equal(requests, expected) {
+		t.Fatalf("expected the requests %v, but got %v", expected, requests)
+	}
+
+	// another run looks it up again
+	if _, err := Projects(WithMemo(context.Background()), []string{"sodium"}); err != nil {
+		t.Fatal(err.Error())
+	} else if len(requests) != len(expected)+1 {
+		t.Fatalf("expected another request, but got %v", requests)
+	}
+}
@@ -0,0 +1,446 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/voidwyrm-2/matrix/api/errs"
+	"github.com/voidwyrm-2/matrix/api/remotemod"
+)
+
+// the resolver gives up instead of searching forever on pathological packs
+const maxSteps = 100000
+
+type Source interface {
+	// should return the project with Versions narrowed down to the ones usable with the game version and modloader, preferred first
+	Project(ctx context.Context, idOrSlug, gameVersion, modloader string) (remotemod.RemoteMod, error)
+	Version(ctx context.Context, id string) (remotemod.RemoteModVersion, error)
+}
+
+type Requirement struct {
+	// the id or slug of the project
+	Project string
+	// a version id the project is pinned to, if any
+	Version string
+	// overrides the pack's modloader for this project and everything it depends on
+	Loader string
+	// the project id of whatever required this, empty for mods listed by the user
+	RequiredBy string
+	// projects tried in order when this one has no usable version, only for mods listed by the user
+	Alternatives []Requirement
+}
+
+type Pick struct {
+	Mod        remotemod.RemoteMod
+	Version    remotemod.RemoteModVersion
+	Loader     string
+	RequiredBy []string
+}
+
+type Solution struct {
+	Picks []Pick
+	index map[string]int
+	// root project -> the alternative that was used for it
+	chosen map[string]string
+}
+
+func (s Solution) Get(idOrSlug string) (Pick, bool) {
+	if i, ok := s.index[idOrSlug]; ok {
+		return s.Picks[i], true
+	}
+
+	return Pick{}, false
+}
+
+// the project, as it was required, that was used for a root with alternatives
+func (s Solution) Chosen(idOrSlug string) string {
+	return s.chosen[idOrSlug]
+}
+
+type Conflict struct {
+	Project string
+	Reasons []string
+	// the projects whose choices led to this conflict, "" stands for the user
+	culprits map[string]struct{}
+}
+
+func (c *Conflict) involves(id string) bool {
+	_, ok := c.culprits[id]
+	return ok
+}
+
+func (c *Conflict) blame(ids ...string) {
+	for _, id := range ids {
+		c.culprits[id] = struct{}{}
+	}
+}
+
+func (c *Conflict) Is(target error) bool {
+	return target == errs.ErrIncompatible
+}
+
+func (c *Conflict) Error() string {
+	return strings.TrimSpace(c.format(""))
+}
+
+func (c *Conflict) format(indent string) string {
+	if len(c.Reasons) == 1 {
+		return fmt.Sprintf("%scannot resolve '%s': %s\n", indent, c.Project, c.Reasons[0])
+	}
+
+	b := strings.Builder{}
+	b.WriteString(fmt.Sprintf("%scannot resolve '%s':\n", indent, c.Project))
+
+	for _, r := range c.Reasons {
+		b.WriteString(fmt.Sprintf("%s  - %s\n", indent, strings.ReplaceAll(r, "\n", "\n"+indent+"    ")))
+	}
+
+	return b.String()
+}
+
+type state struct {
+	picks map[string]Pick
+	order []string
+	// project id -> version id ("" for every version) -> project id of whatever forbids it
+	forbidden map[string]map[string]string
+}
+
+func (st state) forbid(id, versionId, by string) {
+	m := map[string]string{}
+	for k, v := range st.forbidden[id] {
+		m[k] = v
+	}
+
+	m[versionId] = by
+	st.forbidden[id] = m
+}
+
+func (st state) with(id string, p Pick) state {
+	next := state{picks: make(map[string]Pick, len(st.picks)+1), forbidden: make(map[string]map[string]string, len(st.forbidden)), order: st.order}
+
+	for k, v := range st.picks {
+		next.picks[k] = v
+	}
+
+	for k, v := range st.forbidden {
+		next.forbidden[k] = v
+	}
+
+	if _, ok := st.picks[id]; !ok {
+		next.order = append(slices.Clip(st.order), id)
+	}
+
+	next.picks[id] = p
+
+	return next
+}
+
+type Resolver struct {
+	gameVersion, modloader string
+	src                    Source
+	projects               map[string]remotemod.RemoteMod
+	steps                  int
+
+	// decides if a required dependency should be left out, e.g. Fabric API on loaders that don't need it
+	Skip func(dep remotemod.RemoteModVersionDependency, loader string) bool
+}
+
+func New(src Source, gameVersion, modloader string) *Resolver {
+	return &Resolver{gameVersion: gameVersion, modloader: modloader, src: src, projects: map[string]remotemod.RemoteMod{}}
+}
+
+func (r *Resolver) Resolve(ctx context.Context, roots []Requirement) (Solution, error) {
+	r.steps = 0
+
+	for i := range roots {
+		if roots[i].Loader == "" {
+			roots[i].Loader = r.modloader
+		}
+
+		for j := range roots[i].Alternatives {
+			if roots[i].Alternatives[j].Loader == "" {
+				roots[i].Alternatives[j].Loader = r.modloader
+			}
+		}
+	}
+
+	st, err := r.solve(ctx, state{picks: map[string]Pick{}, forbidden: map[string]map[string]string{}}, roots)
+	if err != nil {
+		return Solution{}, err
+	}
+
+	sol := Solution{index: map[string]int{}, chosen: map[string]string{}}
+
+	for i, id := range st.order {
+		p := st.picks[id]
+		sol.Picks = append(sol.Picks, p)
+		sol.index[p.Mod.Id], sol.index[p.Mod.Slug] = i, i
+	}
+
+	for _, req := range roots {
+		for _, opt := range options(req) {
+			p, ok := r.projects[r.key(opt.Project, opt.Loader)]
+			if _, picked := st.picks[p.Id]; ok && picked {
+				sol.index[req.Project] = sol.index[p.Id]
+
+				if len(req.Alternatives) > 0 {
+					sol.chosen[req.Project] = opt.Project
+				}
+
+				break
+			}
+		}
+	}
+
+	return sol, nil
+}
+
+// the requirement itself followed by its alternatives
+func options(req Requirement) []Requirement {
+	first := req
+	first.Alternatives = nil
+
+	return append([]Requirement{first}, req.Alternatives...)
+}
+
+func (r *Resolver) key(idOrSlug, loader string) string {
+	return idOrSlug + "\x00" + loader
+}
+
+func (r *Resolver) project(ctx context.Context, idOrSlug, loader string) (remotemod.RemoteMod, error) {
+	if p, ok := r.projects[r.key(idOrSlug, loader)]; ok {
+		return p, nil
+	}
+
+	p, err := r.src.Project(ctx, idOrSlug, r.gameVersion, loader)
+	if err != nil {
+		return remotemod.RemoteMod{}, err
+	}
+
+	r.projects[r.key(idOrSlug, loader)], r.projects[r.key(p.Id, loader)], r.projects[r.key(p.Slug, loader)] = p, p, p
+
+	return p, nil
+}
+
+func (r *Resolver) name(id string) string {
+	if id == "" {
+		return "the Matrixfile"
+	}
+
+	for _, p := range r.projects {
+		if p.Id == id {
+			return "'" + p.Slug + "'"
+		}
+	}
+
+	return "'" + id + "'"
+}
+
+func (r *Resolver) candidates(ctx context.Context, p remotemod.RemoteMod, req Requirement) ([]remotemod.RemoteModVersion, error) {
+	if req.Version == "" {
+		return p.Versions, nil
+	}
+
+	for _, v := range p.Versions {
+		if v.Id == req.Version {
+			return []remotemod.RemoteModVersion{v}, nil
+		}
+	}
+
+	// pinned versions are trusted even if they don't claim to support the game version
+	v, err := r.src.Version(ctx, req.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	return []remotemod.RemoteModVersion{v}, nil
+}
+
+func (r *Resolver) requirements(ctx context.Context, p remotemod.RemoteMod, v remotemod.RemoteModVersion, loader string) ([]Requirement, error) {
+	reqs := []Requirement{}
+
+	for _, d := range v.Dependencies {
+		if d.Kind != "required" || (r.Skip != nil && r.Skip(d, loader)) {
+			continue
+		}
+
+		project := d.ProjectId
+		if project == "" && d.VersionId != "" {
+			dv, err := r.src.Version(ctx, d.VersionId)
+			if err != nil {
+				return nil, err
+			}
+
+			project = dv.ProjectId
+		}
+
+		if project == "" {
+			continue
+		}
+
+		reqs = append(reqs, Requirement{Project: project, Version: d.VersionId, Loader: loader, RequiredBy: p.Id})
+	}
+
+	return reqs, nil
+}
+
+// checks the candidate against what has already been picked
+func (r *Resolver) clash(st state, v remotemod.RemoteModVersion) (string, string) {
+	for _, versionId := range []string{"", v.Id} {
+		if by, ok := st.forbidden[v.ProjectId][versionId]; ok {
+			return fmt.Sprintf("version %s is incompatible with %s", v.VersionNumber, r.name(by)), by
+		}
+	}
+
+	for _, d := range v.Dependencies {
+		if d.Kind != "incompatible" {
+			continue
+		}
+
+		if pick, ok := st.picks[d.ProjectId]; ok && (d.VersionId == "" || d.VersionId == pick.Version.Id) {
+			return fmt.Sprintf("version %s is incompatible with '%s' %s", v.VersionNumber, pick.Mod.Slug, pick.Version.VersionNumber), d.ProjectId
+		}
+	}
+
+	return "", ""
+}
+
+func (r *Resolver) solve(ctx context.Context, st state, queue []Requirement) (state, error) {
+	if len(queue) == 0 {
+		return st, nil
+	} else if err := ctx.Err(); err != nil {
+		return state{}, err
+	}
+
+	if r.steps++; r.steps > maxSteps {
+		return state{}, errs.Errorf(errs.ErrIncompatible, "gave up resolving dependencies after %d steps", maxSteps)
+	}
+
+	req, rest := queue[0], queue[1:]
+
+	if len(req.Alternatives) > 0 {
+		return r.alternatives(ctx, st, req, rest)
+	}
+
+	p, err := r.project(ctx, req.Project, req.Loader)
+	if err != nil {
+		return state{}, err
+	}
+
+	if pick, ok := st.picks[p.Id]; ok {
+		if req.Version != "" && pick.Version.Id != req.Version {
+			c := &Conflict{Project: p.Slug, culprits: map[string]struct{}{}}
+			c.Reasons = append(c.Reasons, fmt.Sprintf("%s requires a different version than the %s required by %s", r.name(req.RequiredBy), pick.Version.VersionNumber, strings.Join(r.names(pick.RequiredBy), ", ")))
+			c.blame(p.Id, req.RequiredBy)
+			c.blame(pick.RequiredBy...)
+			return state{}, c
+		}
+
+		if !slices.Contains(pick.RequiredBy, req.RequiredBy) {
+			pick.RequiredBy = append(slices.Clip(pick.RequiredBy), req.RequiredBy)
+			st = st.with(p.Id, pick)
+		}
+
+		return r.solve(ctx, st, rest)
+	}
+
+	c := &Conflict{Project: p.Slug, culprits: map[string]struct{}{}}
+	c.blame(req.RequiredBy)
+
+	cands, err := r.candidates(ctx, p, req)
+	if err != nil {
+		return state{}, err
+	}
+
+	if len(cands) == 0 {
+		c.Reasons = append(c.Reasons, fmt.Sprintf("no versions found for Minecraft %s with modloader %s (required by %s)", r.gameVersion, req.Loader, r.name(req.RequiredBy)))
+		return state{}, c
+	}
+
+	for _, v := range cands {
+		if reason, culprit := r.clash(st, v); reason != "" {
+			c.Reasons = append(c.Reasons, reason)
+			c.blame(culprit)
+			continue
+		}
+
+		next := st.with(p.Id, Pick{Mod: p, Version: v, Loader: req.Loader, RequiredBy: []string{req.RequiredBy}})
+
+		for _, d := range v.Dependencies {
+			if d.Kind == "incompatible" && d.ProjectId != "" {
+				next.forbid(d.ProjectId, d.VersionId, p.Id)
+			}
+		}
+
+		deps, err := r.requirements(ctx, p, v, req.Loader)
+		if err != nil {
+			return state{}, err
+		}
+
+		res, err := r.solve(ctx, next, append(slices.Clip(rest), deps...))
+		if err == nil {
+			return res, nil
+		}
+
+		var child *Conflict
+		if !errors.As(err, &child) {
+			return state{}, err
+		} else if !child.involves(p.Id) {
+			// picking another version of this project wouldn't change anything
+			return state{}, child
+		}
+
+		c.Reasons = append(c.Reasons, fmt.Sprintf("version %s:\n%s", v.VersionNumber, strings.TrimSpace(child.format(""))))
+
+		for id := range child.culprits {
+			if id != p.Id {
+				c.blame(id)
+			}
+		}
+	}
+
+	return state{}, c
+}
+
+// tries each alternative in order, the first that leads to a solution wins
+func (r *Resolver) alternatives(ctx context.Context, st state, req Requirement, rest []Requirement) (state, error) {
+	projects := []string{}
+	for _, opt := range options(req) {
+		projects = append(projects, opt.Project)
+	}
+
+	c := &Conflict{Project: strings.Join(projects, " | "), culprits: map[string]struct{}{}}
+	c.blame(req.RequiredBy)
+
+	for _, opt := range options(req) {
+		res, err := r.solve(ctx, st, append([]Requirement{opt}, rest...))
+		if err == nil {
+			return res, nil
+		}
+
+		var child *Conflict
+		if !errors.As(err, &child) {
+			return state{}, err
+		}
+
+		c.Reasons = append(c.Reasons, strings.TrimSpace(child.format("")))
+
+		for id := range child.culprits {
+			c.blame(id)
+		}
+	}
+
+	return state{}, c
+}
+
+func (r *Resolver) names(ids []string) []string {
+	names := []string{}
+	for _, id := range ids {
+		names = append(names, r.name(id))
+	}
+
+	return names
+}
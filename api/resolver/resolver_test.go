@@ -0,0 +1,168 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/voidwyrm-2/matrix/api/remotemod"
+)
+
+type fakeSource map[string][]remotemod.RemoteModVersion
+
+func (fs fakeSource) Project(_ context.Context, idOrSlug, gameVersion, modloader string) (remotemod.RemoteMod, error) {
+	versions, ok := fs[idOrSlug]
+	if !ok {
+		return remotemod.RemoteMod{}, fmt.Errorf("no project '%s'", idOrSlug)
+	}
+
+	return remotemod.RemoteMod{Id: idOrSlug, Slug: idOrSlug, Versions: versions}, nil
+}
+
+func (fs fakeSource) Version(_ context.Context, id string) (remotemod.RemoteModVersion, error) {
+	for _, versions := range fs {
+		for _, v := range versions {
+			if v.Id == id {
+				return v, nil
+			}
+		}
+	}
+
+	return remotemod.RemoteModVersion{}, fmt.Errorf("no version '%s'", id)
+}
+
+func ver(project, number string, deps ...string) remotemod.RemoteModVersion {
+	v := remotemod.RemoteModVersion{Id: project + "@" + number, ProjectId: project, VersionNumber: number}
+
+	for _, d := range deps {
+		kind := "required"
+		if strings.HasPrefix(d, "!") {
+			kind, d = "incompatible", d[1:]
+		}
+
+		dep := remotemod.RemoteModVersionDependency{Kind: kind, ProjectId: strings.Split(d, "@")[0]}
+		if strings.Contains(d, "@") {
+			dep.VersionId = d
+		}
+
+		v.Dependencies = append(v.Dependencies, dep)
+	}
+
+	return v
+}
+
+func TestResolve(t *testing.T) {
+	src := fakeSource{
+		"a":   {ver("a", "2", "lib@1"), ver("a", "1")},
+		"b":   {ver("b", "3", "lib@2"), ver("b", "2", "lib@1")},
+		"lib": {ver("lib", "2"), ver("lib", "1")},
+		"c":   {ver("c", "1", "!b")},
+		"d":   {ver("d", "2", "!lib@2"), ver("d", "1")},
+	}
+
+	cases := []struct {
+		roots  []string
+		expect string
+	}{
+		{[]string{"a", "b"}, "a@2 b@2 lib@1"},
+		{[]string{"b", "a"}, "b@3 a@1 lib@2"},
+		{[]string{"lib", "a"}, "lib@2 a@1"},
+		{[]string{"b", "d"}, "b@3 d@1 lib@2"},
+		{[]string{"d", "b"}, "d@2 b@2 lib@1"},
+	}
+
+	for _, c := range cases {
+		roots := []Requirement{}
+		for _, r := range c.roots {
+			roots = append(roots, Requirement{Project: r})
+		}
+
+		sol, err := New(src, "1.21.1", "fabric").Resolve(context.Background(), roots)
+		if err != nil {
+			t.Fatalf("resolving %v: %s", c.roots, err.Error())
+		}
+
+		picked := []string{}
+		for _, p := range sol.Picks {
+			picked = append(picked, p.Version.Id)
+		}
+
+		if result := strings.Join(picked, " "); result != c.expect {
+			t.Fatalf("expected %v to resolve to `%s`, but got `%s` instead", c.roots, c.expect, result)
+		}
+	}
+
+	_, err := New(src, "1.21.1", "fabric").Resolve(context.Background(), []Requirement{{Project: "b"}, {Project: "c"}})
+
+	var conflict *Conflict
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected a conflict, but got `%v` instead", err)
+	} else if !strings.Contains(err.Error(), "incompatible with 'b'") {
+		t.Fatalf("unexpected explanation `%s`", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := New(src, "1.21.1", "fabric").Resolve(ctx, []Requirement{{Project: "a"}}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected resolving to be cancelled, but got `%v` instead", err)
+	}
+}
+
+func TestAlternatives(t *testing.T) {
+	src := fakeSource{
+		"sodium":    {},
+		"embeddium": {ver("embeddium", "1")},
+		"rubidium":  {ver("rubidium", "1")},
+		"oculus":    {ver("oculus", "1", "!embeddium")},
+	}
+
+	cases := []struct {
+		roots          []string
+		expect, chosen string
+	}{
+		{[]string{"sodium|embeddium|rubidium"}, "embeddium@1", "embeddium"},
+		{[]string{"oculus", "sodium|embeddium|rubidium"}, "oculus@1 rubidium@1", "rubidium"},
+		{[]string{"rubidium|embeddium"}, "rubidium@1", "rubidium"},
+	}
+
+	for _, c := range cases {
+		roots := []Requirement{}
+		for _, r := range c.roots {
+			projects := strings.Split(r, "|")
+			req := Requirement{Project: projects[0]}
+
+			for _, alt := range projects[1:] {
+				req.Alternatives = append(req.Alternatives, Requirement{Project: alt})
+			}
+
+			roots = append(roots, req)
+		}
+
+		sol, err := New(src, "1.21.1", "fabric").Resolve(context.Background(), roots)
+		if err != nil {
+			t.Fatalf("resolving %v: %s", c.roots, err.Error())
+		}
+
+		picked := []string{}
+		for _, p := range sol.Picks {
+			picked = append(picked, p.Version.Id)
+		}
+
+		last := roots[len(roots)-1].Project
+		if result := strings.Join(picked, " "); result != c.expect {
+			t.Fatalf("expected %v to resolve to `%s`, but got `%s` instead", c.roots, c.expect, result)
+		} else if chosen := sol.Chosen(last); chosen != c.chosen {
+			t.Fatalf("expected '%s' to be chosen for %v, but got '%s' instead", c.chosen, c.roots, chosen)
+		} else if p, _ := sol.Get(last); p.Mod.Id != c.chosen {
+			t.Fatalf("expected '%s' to be picked for '%s', but got '%s' instead", c.chosen, last, p.Mod.Id)
+		}
+	}
+
+	_, err := New(src, "1.21.1", "fabric").Resolve(context.Background(), []Requirement{{Project: "oculus"}, {Project: "sodium", Alternatives: []Requirement{{Project: "embeddium"}}}})
+	if err == nil || !strings.Contains(err.Error(), "cannot resolve 'sodium | embeddium'") {
+		t.Fatalf("expected no alternative to work, but got `%v` instead", err)
+	}
+}
@@ -46,6 +46,29 @@ func (v Version) Cmp(other Version) int {
 	return 0
 }
 
+// compares section by section, treating missing sections as 0, so 1.21 is newer than 1.20.6 and the same as 1.21.0
+func (v Version) Compare(other Version) int {
+	for i := 0; i < len(v.sections) || i < len(other.sections); i++ {
+		a, b := uint16(0), uint16(0)
+
+		if i < len(v.sections) {
+			a = v.sections[i]
+		}
+
+		if i < len(other.sections) {
+			b = other.sections[i]
+		}
+
+		if a < b {
+			return -1
+		} else if a > b {
+			return 1
+		}
+	}
+
+	return 0
+}
+
 func (v Version) Eq(other Version) bool {
 	return v.Cmp(other) == 0
 }
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/voidwyrm-2/matrix/api/config"
+)
+
+var config_global *bool
+
+// the config key for a flag, which is just its name for the flags every command has
+func configKey(cmd *cobra.Command, f *pflag.Flag) string {
+	if rootCmd.PersistentFlags().Lookup(f.Name) == f {
+		return f.Name
+	}
+
+	return strings.Join(append(strings.Fields(cmd.CommandPath())[1:], f.Name), ".")
+}
+
+// every key that can be set, and the flag it sets
+func configKeys() map[string]*pflag.Flag {
+	keys := map[string]*pflag.Flag{}
+
+	var walk func(cmd *cobra.Command)
+	walk = func(cmd *cobra.Command) {
+		cmd.LocalFlags().VisitAll(func(f *pflag.Flag) {
+			if f.Name != "help" {
+				keys[configKey(cmd, f)] = f
+			}
+		})
+
+		for _, sub := range cmd.Commands() {
+			walk(sub)
+		}
+	}
+
+	walk(rootCmd)
+
+	return keys
+}
+
+func sortedKeys() []string {
+	keys := []string{}
+	for k := range configKeys() {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
+func loadConfig() ([]config.Layer, error) {
+	return config.Load(sortedKeys())
+}
+
+// --dir can only come from the user's config or the environment, since it decides which pack's config is read
+func applyDir(cmd *cobra.Command) error {
+	if cmd.Flags().Changed("dir") {
+		return nil
+	}
+
+	dir, ok := os.LookupEnv(config.EnvName("dir"))
+	if !ok {
+		if path, err := config.UserPath(); err == nil {
+			user, err := config.Read(path)
+			if err != nil {
+				return err
+			}
+
+			dir, ok = user.Values["dir"]
+		}
+	}
+
+	if ok {
+		return cmd.Flags().Set("dir", dir)
+	}
+
+	return nil
+}
+
+// sets every flag that wasn't given from the config, the environment winning over the pack's config, and that over the user's
+func applyConfig(cmd *cobra.Command) error {
+	layers, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	var e error
+
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if e != nil || f.Changed || f.Name == "dir" || f.Name == "help" {
+			return
+		}
+
+		key := configKey(cmd, f)
+		if v, from, ok := config.Lookup(layers, key); ok {
+			if err := f.Value.Set(v); err != nil {
+				e = fmt.Errorf("invalid value '%s' for '%s' in %s: %s", v, key, from, err.Error())
+			}
+		}
+	})
+
+	return e
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Gets and sets the defaults for flags",
+	Long: `Gets and sets the defaults for flags. Defaults are read from the user's config ($XDG_CONFIG_HOME/matrix/config.toml),
+then the pack's config (.matrix/config.toml), then MATRIX_* environment variables, and flags given on the command line win over all of them.
+Keys are the names of flags every command has, like 'instance-dir', or the command and flag, like 'sync.side'`,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Prints the value of a key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f, ok := configKeys()[args[0]]
+		if !ok {
+			return fmt.Errorf("unknown key '%s'", args[0])
+		}
+
+		layers, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		if v, _, ok := config.Lookup(layers, args[0]); ok {
+			fmt.Println(v)
+		} else {
+			fmt.Println(f.DefValue)
+		}
+
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Sets a key in the pack's config, or the user's with --global",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f, ok := configKeys()[args[0]]
+		if !ok {
+			return fmt.Errorf("unknown key '%s'", args[0])
+		} else if args[0] == "dir" && !*config_global {
+			return fmt.Errorf("'dir' can only be set in the user's config, since it decides which pack's config is read")
+		}
+
+		if err := checkValue(f, args[1]); err != nil {
+			return fmt.Errorf("invalid value '%s' for '%s': %s", args[1], args[0], err.Error())
+		}
+
+		path := config.ProjectPath
+		if *config_global {
+			p, err := config.UserPath()
+			if err != nil {
+				return err
+			}
+
+			path = p
+		}
+
+		file, err := config.Read(path)
+		if err != nil {
+			return err
+		}
+
+		file.Values[args[0]] = args[1]
+
+		return file.Write()
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Prints every key that's set and where it was set",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		layers, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		for _, k := range sortedKeys() {
+			if v, from, ok := config.Lookup(layers, k); ok {
+				fmt.Printf("%s = %s (%s)\n", k, v, from)
+			}
+		}
+
+		return nil
+	},
+}
+
+// checks that the flag would take the value
+func checkValue(f *pflag.Flag, value string) error {
+	var err error
+
+	switch f.Value.Type() {
+	case "bool":
+		_, err = strconv.ParseBool(value)
+	case "int", "count":
+		_, err = strconv.Atoi(value)
+	}
+
+	return err
+}
+
+func init() {
+	config_global = configSetCmd.Flags().BoolP("global", "g", false, "Set the key in the user's config instead of the pack's")
+
+	configCmd.AddCommand(configGetCmd, configSetCmd, configListCmd)
+	rootCmd.AddCommand(configCmd)
+}
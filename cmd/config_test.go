@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/voidwyrm-2/matrix/api/config"
+)
+
+func TestConfigPrecedence(t *testing.T) {
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+
+	home, dir := t.TempDir(), t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	os.Chdir(dir)
+
+	user := filepath.Join(home, "matrix", "config.toml")
+	os.MkdirAll(filepath.Dir(user), os.ModePerm)
+	os.MkdirAll(filepath.Dir(config.ProjectPath), os.ModePerm)
+
+	keys := []string{"instance-dir", "offline"}
+	for _, k := range keys {
+		defer os.Unsetenv(config.EnvName(k))
+	}
+
+	cases := []struct {
+		user, project string
+		env           map[string]string
+		args          []string
+		instanceDir   string
+		offline       bool
+	}{
+		{"", "", nil, nil, "", false},
+		{"instance-dir = \"user\"\noffline = true\n", "", nil, nil, "user", true},
+		{"instance-dir = \"user\"\noffline = true\n", "instance-dir = \"project\"\noffline = false\n", nil, nil, "project", false},
+		{"offline = true\n", "instance-dir = \"project\"\n", map[string]string{"instance-dir": "env", "offline": "false"}, nil, "env", false},
+		{"", "instance-dir = \"project\"\n", map[string]string{"instance-dir": "env", "offline": "false"}, []string{"--instance-dir", "flag", "--offline"}, "flag", true},
+	}
+
+	for i, c := range cases {
+		os.WriteFile(user, []byte(c.user), 0644)
+		os.WriteFile(config.ProjectPath, []byte(c.project), 0644)
+
+		for _, k := range keys {
+			if v, ok := c.env[k]; ok {
+				os.Setenv(config.EnvName(k), v)
+			} else {
+				os.Unsetenv(config.EnvName(k))
+			}
+		}
+
+		// every subcommand has to see the flags every command has, lint included
+		lintCmd.Flags().VisitAll(func(f *pflag.Flag) {
+			f.Value.Set(f.DefValue)
+			f.Changed = false
+		})
+
+		if err := lintCmd.ParseFlags(c.args); err != nil {
+			t.Fatal(err.Error())
+		} else if err := applyConfig(lintCmd); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if *root_instanceDir != c.instanceDir || *root_offline != c.offline {
+			t.Fatalf("case %d: expected instance-dir '%s' and offline %t, but got '%s' and %t", i, c.instanceDir, c.offline, *root_instanceDir, *root_offline)
+		}
+	}
+}
@@ -1,54 +1,44 @@
 package cmd
 
 import (
-	"fmt"
+	"errors"
+	"io/fs"
 	"os"
-	"strings"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
+	"github.com/voidwyrm-2/matrix/api/matrixfile"
 	"github.com/voidwyrm-2/matrix/api/modpack"
 )
 
 var demakeCmd = &cobra.Command{
 	Use:   "demake",
 	Short: "Generates a Matrixfile from a matrix.toml",
-	Long:  ``,
+	Long:  `Generates a Matrixfile from a matrix.toml, or updates the existing one to match it while keeping its comments and order`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		pack, err := modpack.FromToml("matrix.toml", false, false)
+		pack, err := modpack.FromToml(*root_packFile, false, false)
 		if err != nil {
 			return err
 		}
 
-		mods := []string{}
+		gen := pack.ToMatrixfile()
 
-		for _, mod := range pack.Mods() {
-			entry := ""
-			p := mod.ToPublic()
+		original, _, err := matrixfile.Open(*root_matrixfile)
 
-			if p.Slug != "" {
-				entry += p.Slug
-			} else if p.Id != "" {
-				entry += "id " + p.Id
-			} else {
-				continue
-			}
-
-			if p.ForceVersion != "" {
-				entry += " " + p.ForceVersion
+		// only a Matrixfile that isn't there is made from scratch, not one that can't be read or has an include that's missing
+		var fileErr *matrixfile.Error
+		if err != nil && (!errors.Is(err, fs.ErrNotExist) || errors.As(err, &fileErr)) {
+			return err
+		} else if err != nil {
+			path := *root_matrixfile
+			if info, err := os.Stat(path); path == "" || (err == nil && info.IsDir()) {
+				path = filepath.Join(path, "matrixfile")
 			}
 
-			mods = append(mods, entry)
-		}
-
-		f, err := os.Create("matrixfile")
-		if err != nil {
-			return err
+			return matrixfile.WriteFile(path, gen.Format(false))
 		}
 
-		defer f.Close()
-
-		_, err = f.Write([]byte(fmt.Sprintf("%s\n%s\n%s\n%s\n\n", pack.Name(), pack.Version(), pack.GameVersion(), pack.Modloader()) + strings.Join(mods, "\n")))
-		return err
+		return matrixfile.WriteFile(original.Path, original.Merge(gen, matrixfile.Target{Loader: pack.Modloader(), GameVersion: pack.GameVersion()}).Bytes())
 	},
 }
 
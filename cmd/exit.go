@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/voidwyrm-2/matrix/api/errs"
+	"github.com/voidwyrm-2/matrix/api/logging"
+)
+
+// the exit codes for each kind of error, which are listed in the docs
+const (
+	ExitError        = 1
+	ExitUsage        = 2
+	ExitParse        = 3
+	ExitNotFound     = 4
+	ExitIncompatible = 5
+	ExitNetwork      = 6
+	ExitHashMismatch = 7
+	// like a shell does for SIGINT
+	ExitInterrupted = 130
+)
+
+// an error from the command line itself, like an unknown flag or the wrong number of arguments
+type usageError struct {
+	err  error
+	path string
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+func ExitCode(err error) int {
+	var usage *usageError
+
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, context.Canceled):
+		return ExitInterrupted
+	case errors.As(err, &usage):
+		return ExitUsage
+	case errors.Is(err, errs.ErrParse):
+		return ExitParse
+	case errors.Is(err, errs.ErrHashMismatch):
+		return ExitHashMismatch
+	case errors.Is(err, errs.ErrNotFound), errors.Is(err, fs.ErrNotExist):
+		return ExitNotFound
+	case errors.Is(err, errs.ErrIncompatible):
+		return ExitIncompatible
+	case errors.Is(err, errs.ErrNetwork), errors.Is(err, errs.ErrOffline):
+		return ExitNetwork
+	default:
+		return ExitError
+	}
+}
+
+// prints the error the way matrix prints everything else
+func PrintError(err error) {
+	msg := "error: " + err.Error()
+	if errors.Is(err, context.Canceled) {
+		// every download that was cancelled would say so otherwise
+		msg = "interrupted"
+	}
+
+	if logging.ShouldColor(os.Stderr) {
+		msg = "\033[91m" + msg + "\033[0m"
+	}
+
+	fmt.Fprintln(os.Stderr, msg)
+
+	var usage *usageError
+	if errors.As(err, &usage) {
+		fmt.Fprintf(os.Stderr, "run '%s --help' for usage\n", usage.path)
+	}
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+	"github.com/voidwyrm-2/matrix/api/matrixfile"
+)
+
+var fmt_check, fmt_sort *bool
+
+var fmtCmd = &cobra.Command{
+	Use:   "fmt",
+	Short: "Rewrites the Matrixfile in its canonical form",
+	Long:  ``,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f, content, err := matrixfile.Open(*root_matrixfile)
+		if err != nil {
+			return err
+		}
+
+		formatted := f.Format(*fmt_sort)
+
+		if bytes.Equal(content, formatted) {
+			return nil
+		} else if *fmt_check {
+			return fmt.Errorf("'%s' isn't formatted, run 'matrix fmt' to fix it", f.Path)
+		}
+
+		if err = matrixfile.WriteFile(f.Path, formatted); err != nil {
+			return err
+		}
+
+		slog.Info(fmt.Sprintf("formatted '%s'", f.Path), "file", f.Path)
+
+		return nil
+	},
+}
+
+func init() {
+	fmt_check = fmtCmd.Flags().Bool("check", false, "Don't write anything, but fail if the Matrixfile isn't formatted")
+	fmt_sort = fmtCmd.Flags().Bool("sort", false, "Sort the mods between blank lines, includes and excludes")
+
+	rootCmd.AddCommand(fmtCmd)
+}
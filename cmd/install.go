@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/voidwyrm-2/matrix/api/modpack"
+)
+
+var install_frozen, install_ignoreExternals, install_force *bool
+var install_side, install_profile *string
+
+var installCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Download exactly the files recorded in the matrix.toml",
+	Long:  `Downloads the version of each mod that was picked by the last sync, checking every file against its hash, without looking anything up on Modrinth. With --frozen it also fails if the Matrixfile has changed since the matrix.toml was made, which is what CI and players' machines should use`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pack, err := modpack.FromToml(*root_packFile, false, *install_ignoreExternals)
+		if err != nil {
+			return err
+		}
+
+		pack.SetInstanceDir(*root_instanceDir)
+		pack.SetObserver(newObserver())
+
+		if err = pack.SetConcurrency(*root_concurrency); err != nil {
+			return err
+		} else if err = pack.SelectProfile(*install_profile); err != nil {
+			return err
+		}
+
+		if *install_frozen {
+			if err = pack.CheckMatrixfile(cmd.Context(), *root_matrixfile); err != nil {
+				return err
+			}
+		}
+
+		plan, err := pack.FrozenPlan()
+		if err != nil {
+			return err
+		}
+
+		err = pack.ApplyOverrides(cmd.Context(), *install_side, *install_force)
+		if err != nil {
+			return err
+		}
+
+		err = pack.Apply(cmd.Context(), plan)
+		if err != nil {
+			return err
+		}
+
+		return pack.Commit(*root_packFile)
+	},
+}
+
+func init() {
+	install_frozen = installCmd.Flags().Bool("frozen", false, "Fail if the Matrixfile and the matrix.toml disagree")
+	install_ignoreExternals = installCmd.Flags().Bool("ext", false, "Don't attempt to download the external mods")
+	install_force = installCmd.Flags().BoolP("force", "f", false, "Overwrite files that were changed since the overrides were last copied")
+	install_profile = installCmd.Flags().StringP("profile", "p", "", "The profile to install, instead of the one chosen by 'make'")
+	install_side = installCmd.Flags().String("side", "client", "Which side's overrides to copy, either 'client' or 'server'")
+
+	rootCmd.AddCommand(installCmd)
+}
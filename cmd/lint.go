@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+	"github.com/voidwyrm-2/matrix/api/cache"
+	"github.com/voidwyrm-2/matrix/api/logging"
+	"github.com/voidwyrm-2/matrix/api/matrixfile"
+	"github.com/voidwyrm-2/matrix/api/modpack"
+)
+
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Checks the Matrixfile for mistakes",
+	Long:  `Checks the Matrixfile for duplicate mods, unknown flags and loaders, and malformed URLs, then checks that every mod exists on Modrinth and has a version for the game version and loader, unless --offline is given`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f, _, err := matrixfile.Open(*root_matrixfile)
+		if err != nil {
+			return err
+		}
+
+		online := !cache.Offline()
+		if online {
+			logging.Progress("checking mods on Modrinth...")
+		}
+
+		problems := modpack.Lint(cmd.Context(), f, online)
+
+		for _, p := range problems {
+			slog.Error(p.Error())
+		}
+
+		if len(problems) == 1 {
+			return fmt.Errorf("found 1 problem")
+		} else if len(problems) > 0 {
+			return fmt.Errorf("found %d problems", len(problems))
+		}
+
+		slog.Info("no problems found")
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+}
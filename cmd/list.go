@@ -12,7 +12,7 @@ var listCmd = &cobra.Command{
 	Short: "Lists all non-external mods currently downloaded",
 	Long:  ``,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		pack, err := modpack.FromToml("matrix.toml", false, false)
+		pack, err := modpack.FromToml(*root_packFile, false, false)
 		if err != nil {
 			return err
 		}
@@ -5,15 +5,21 @@ import (
 	"github.com/voidwyrm-2/matrix/api/modpack"
 )
 
+var make_profile, make_loader, make_game_version *string
+
 var makeCmd = &cobra.Command{
 	Use:   "make",
 	Short: "Generate a matrix.toml from a Matrixfile",
 	Long:  ``,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return modpack.FromMatrixfile("matrix.toml")
+		return modpack.FromMatrixfile(cmd.Context(), *root_packFile, *root_matrixfile, *make_profile, *make_loader, *make_game_version)
 	},
 }
 
 func init() {
+	make_profile = makeCmd.Flags().StringP("profile", "p", "", "The profile to sync when 'sync' isn't given one")
+	make_loader = makeCmd.Flags().String("loader", "", "Use this modloader instead of the one in the Matrixfile")
+	make_game_version = makeCmd.Flags().String("game-version", "", "Use this game version instead of the one in the Matrixfile")
+
 	rootCmd.AddCommand(makeCmd)
 }
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+	"github.com/voidwyrm-2/matrix/api/logging"
+	"github.com/voidwyrm-2/matrix/api/modpack"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrades the matrix.toml to the current schema",
+	Long:  `Upgrades the matrix.toml to the current schema, rewriting it in place. Older files are upgraded automatically when they're read, so this is only needed to check in the new version`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, err := modpack.Migrate(*root_packFile)
+		if err != nil {
+			return err
+		}
+
+		if from == modpack.Schema {
+			logging.Note(fmt.Sprintf("'%s' is already on schema %d", *root_packFile, from), "file", *root_packFile, "schema", from)
+		} else {
+			slog.Info(fmt.Sprintf("migrated '%s' from schema %d to %d", *root_packFile, from, modpack.Schema), "file", *root_packFile, "from", from, "schema", modpack.Schema)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+}
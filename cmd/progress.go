@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/voidwyrm-2/matrix/api/logging"
+	"github.com/voidwyrm-2/matrix/api/modpack"
+)
+
+type bar struct {
+	kind, mod   string
+	done, total int64
+}
+
+// draws a bar for each download below the log, moving them down whenever something is logged
+type progressBars struct {
+	mu   sync.Mutex
+	out  *os.File
+	bars []*bar
+	// how many lines of bars are on the screen, and when they were last drawn
+	drawn int
+	last  time.Time
+}
+
+// the observer for sync, which draws progress bars on a terminal and just logs otherwise
+func newObserver() modpack.Observer {
+	if *root_logFormat != "text" || *root_quiet || *root_verbose > 0 || !logging.IsTerminal(os.Stderr) {
+		return modpack.LogObserver{}
+	}
+
+	return &progressBars{out: os.Stderr}
+}
+
+func (p *progressBars) Notify(e modpack.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch e := e.(type) {
+	case modpack.DownloadStarted:
+		p.bars = append(p.bars, &bar{kind: e.Kind, mod: e.Mod, total: -1})
+		p.redraw()
+		// the bar says it's being downloaded
+		return
+	case modpack.DownloadProgress:
+		for _, b := range p.bars {
+			if b.mod == e.Mod && b.kind == e.Kind {
+				b.done, b.total = e.Bytes, e.Total
+			}
+		}
+
+		if time.Since(p.last) > 50*time.Millisecond {
+			p.redraw()
+		}
+
+		return
+	case modpack.Downloaded:
+		p.remove(e.Kind, e.Mod)
+	case modpack.Failed:
+		p.remove(e.Kind, e.Mod)
+	}
+
+	p.clear()
+	modpack.LogObserver{}.Notify(e)
+	p.draw()
+}
+
+func (p *progressBars) remove(kind, mod string) {
+	p.bars = slices.DeleteFunc(p.bars, func(b *bar) bool { return b.kind == kind && b.mod == mod })
+}
+
+func (p *progressBars) clear() {
+	if p.drawn > 0 {
+		fmt.Fprintf(p.out, "\033[%dA\033[J", p.drawn)
+		p.drawn = 0
+	}
+}
+
+func (p *progressBars) draw() {
+	const width = 30
+
+	for _, b := range p.bars {
+		name := b.mod
+		if len(name) > 24 {
+			name = name[:23] + "…"
+		}
+
+		if b.total <= 0 {
+			fmt.Fprintf(p.out, "%-24s [%s] %s\n", name, strings.Repeat(" ", width), logging.Size(b.done))
+			continue
+		}
+
+		filled := int(min(b.done*width/b.total, width))
+		fmt.Fprintf(p.out, "%-24s [%s%s] %3d%% %s/%s\n", name, strings.Repeat("=", filled), strings.Repeat(" ", width-filled), b.done*100/b.total, logging.Size(b.done), logging.Size(b.total))
+	}
+
+	p.drawn = len(p.bars)
+	p.last = time.Now()
+}
+
+func (p *progressBars) redraw() {
+	p.clear()
+	p.draw()
+}
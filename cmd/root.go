@@ -1,11 +1,30 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
 	"github.com/spf13/cobra"
+	"github.com/voidwyrm-2/matrix/api/cache"
+	"github.com/voidwyrm-2/matrix/api/logging"
+	"github.com/voidwyrm-2/matrix/api/remotemod"
 )
 
 var version string
 
+// whether the command line was parsed and a command was started
+var started bool
+
+var root_dir, root_packFile, root_matrixfile, root_instanceDir, root_mirror, root_channel, root_cacheDir *string
+var root_concurrency, root_verbose *int
+var root_quiet, root_offline *bool
+var root_logFormat *string
+
 var rootCmd = &cobra.Command{
 	Use:   "matrix",
 	Short: "Matrix is a Minecraft mod manager for Modrinth",
@@ -15,13 +34,89 @@ var rootCmd = &cobra.Command{
 func Execute(_version string) error {
 	version = _version
 
-	err := rootCmd.Execute()
-	if err != nil {
+	// the first ctrl-c cancels whatever's running so it can clean up, the second one kills it like normal
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	c, err := rootCmd.ExecuteContextC(ctx)
+	if err != nil && !started {
+		// the command never ran, so the command line was wrong
+		return &usageError{err: err, path: c.CommandPath()}
+	}
+
+	return err
+}
+
+// the folder has to be known before the pack's config can be read
+func setup(cmd *cobra.Command, args []string) error {
+	// cobra only checks these after this has run, but they're still mistakes on the command line
+	if err := cmd.ValidateFlagGroups(); err != nil {
+		return err
+	}
+
+	started = true
+
+	if err := applyDir(cmd); err != nil {
 		return err
+	} else if *root_dir != "" {
+		if err := os.Chdir(*root_dir); err != nil {
+			return err
+		}
 	}
 
+	if err := applyConfig(cmd); err != nil {
+		return err
+	}
+
+	opts := logging.Options{Level: logging.LevelProgress, Color: logging.ShouldColor(os.Stderr)}
+
+	switch {
+	case *root_quiet:
+		opts.Level = slog.LevelWarn
+	case *root_verbose == 1:
+		opts.Level = slog.LevelDebug
+	case *root_verbose > 1:
+		opts.Level = logging.LevelTrace
+	}
+
+	switch *root_logFormat {
+	case "json":
+		opts.Json = true
+	case "text":
+	default:
+		return fmt.Errorf("unknown log format '%s', expected 'text' or 'json'", *root_logFormat)
+	}
+
+	logging.Setup(os.Stderr, opts)
+
+	remotemod.Api = strings.TrimSuffix(*root_mirror, "/")
+
+	cache.SetDir(*root_cacheDir)
+	cache.SetOffline(*root_offline)
+
 	return nil
 }
 
 func init() {
+	rootCmd.PersistentPreRunE = setup
+	rootCmd.SilenceErrors = true
+	rootCmd.SilenceUsage = true
+
+	root_dir = rootCmd.PersistentFlags().StringP("dir", "C", "", "Run as if matrix was started in this folder, which the other paths are relative to")
+	root_packFile = rootCmd.PersistentFlags().String("pack-file", "matrix.toml", "The matrix.toml to read and write")
+	root_matrixfile = rootCmd.PersistentFlags().String("matrixfile", "", "The Matrixfile to read, instead of looking for one in the working directory")
+	root_instanceDir = rootCmd.PersistentFlags().String("instance-dir", "", "The folder the pack is synced to, e.g. a launcher's .minecraft folder, instead of the working directory")
+	root_mirror = rootCmd.PersistentFlags().String("mirror", remotemod.Api, "The Modrinth API to use")
+	root_offline = rootCmd.PersistentFlags().Bool("offline", false, "Don't make any requests, only use what's in the cache")
+	root_cacheDir = rootCmd.PersistentFlags().String("cache-dir", cache.DefaultDir(), "Where Modrinth's responses and downloaded files are kept between runs, nothing is cached if it's empty")
+	root_channel = rootCmd.PersistentFlags().String("channel", "", "The least stable release channel versions are picked from, either 'release', 'beta' or 'alpha'")
+	root_quiet = rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Only print warnings and errors")
+	root_verbose = rootCmd.PersistentFlags().CountP("verbose", "v", "Print more about what's happening, -vv to also print every request")
+	root_logFormat = rootCmd.PersistentFlags().String("log-format", "text", "How to print what's happening, either 'text' or 'json' for one JSON object per line")
+	root_concurrency = rootCmd.PersistentFlags().Int("concurrency", 4, "How many files are downloaded at once")
 }
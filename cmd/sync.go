@@ -1,34 +1,107 @@
 package cmd
 
 import (
+	"os"
+
 	"github.com/spf13/cobra"
 	"github.com/voidwyrm-2/matrix/api/modpack"
 )
 
-var sync_ignoreNonempty, sync_ignoreExternals *bool
+var sync_ignoreNonempty, sync_ignoreExternals, sync_force, sync_dryRun, sync_json *bool
+var sync_side, sync_profile, sync_planOut, sync_planIn *string
 
 var syncCmd = &cobra.Command{
 	Use:   "sync",
 	Short: "Download all mods listed in the matrix.toml",
 	Long:  ``,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		pack, err := modpack.FromToml("matrix.toml", *sync_ignoreNonempty, *sync_ignoreExternals)
+		pack, err := modpack.FromToml(*root_packFile, *sync_ignoreNonempty, *sync_ignoreExternals)
+		if err != nil {
+			return err
+		}
+
+		pack.SetInstanceDir(*root_instanceDir)
+		pack.SetObserver(newObserver())
+
+		if err = pack.SetChannel(*root_channel); err != nil {
+			return err
+		} else if err = pack.SetConcurrency(*root_concurrency); err != nil {
+			return err
+		}
+
+		var plan modpack.Plan
+		profile := *sync_profile
+
+		if *sync_planIn != "" {
+			if plan, err = modpack.ReadPlan(*sync_planIn); err != nil {
+				return err
+			}
+
+			// the plan says which profile it's for
+			if profile == "" {
+				profile = plan.Profile
+			}
+		}
+
+		err = pack.SelectProfile(profile)
 		if err != nil {
 			return err
 		}
 
-		err = pack.Populate()
+		if *sync_planIn == "" {
+			if plan, err = pack.Plan(cmd.Context()); err != nil {
+				return err
+			}
+		}
+
+		if *sync_planOut != "" {
+			f, err := os.Create(*sync_planOut)
+			if err != nil {
+				return err
+			}
+
+			defer f.Close()
+
+			if err = plan.WriteJson(f); err != nil {
+				return err
+			}
+		}
+
+		if *sync_dryRun || *sync_planOut != "" {
+			if *sync_json {
+				return plan.WriteJson(os.Stdout)
+			}
+
+			return plan.WriteTable(os.Stdout)
+		}
+
+		err = pack.ApplyOverrides(cmd.Context(), *sync_side, *sync_force)
 		if err != nil {
 			return err
 		}
 
-		return pack.ToToml("matrix.toml")
+		err = pack.Apply(cmd.Context(), plan)
+		if err != nil {
+			return err
+		}
+
+		return pack.Commit(*root_packFile)
 	},
 }
 
 func init() {
 	sync_ignoreNonempty = syncCmd.Flags().BoolP("empty", "e", false, "Only sync empty mods")
 	sync_ignoreExternals = syncCmd.Flags().Bool("ext", false, "Don't attempt to download the external mods")
+	sync_force = syncCmd.Flags().BoolP("force", "f", false, "Overwrite files that were changed since the overrides were last copied")
+	sync_profile = syncCmd.Flags().StringP("profile", "p", "", "The profile to sync, instead of the one chosen by 'make'")
+	sync_side = syncCmd.Flags().String("side", "client", "Which side's overrides to copy, either 'client' or 'server'")
+	sync_dryRun = syncCmd.Flags().BoolP("dry-run", "n", false, "Print what the sync would change without changing anything")
+	sync_json = syncCmd.Flags().Bool("json", false, "Print the plan as JSON instead of a table")
+	sync_planOut = syncCmd.Flags().String("plan-out", "", "Write what the sync would change to a file to be applied later with --plan-in, without changing anything")
+	sync_planIn = syncCmd.Flags().String("plan-in", "", "Apply a plan written by --plan-out, instead of working out what to change again")
+
+	syncCmd.MarkFlagsMutuallyExclusive("plan-in", "plan-out")
+	syncCmd.MarkFlagsMutuallyExclusive("plan-in", "dry-run")
 
 	rootCmd.AddCommand(syncCmd)
 }
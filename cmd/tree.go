@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/voidwyrm-2/matrix/api/modpack"
+)
+
+var tree_format *string
+
+var treeCmd = &cobra.Command{
+	Use:   "tree",
+	Short: "Prints the mods in the matrix.toml along with what they depend on",
+	Long:  ``,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pack, err := modpack.FromToml(*root_packFile, false, false)
+		if err != nil {
+			return err
+		}
+
+		switch *tree_format {
+		case "text":
+			return pack.WriteTree(os.Stdout)
+		case "dot":
+			return pack.WriteDot(os.Stdout)
+		default:
+			return fmt.Errorf("unknown format '%s', expected 'text' or 'dot'", *tree_format)
+		}
+	},
+}
+
+func init() {
+	tree_format = treeCmd.Flags().String("format", "text", "The output format, either 'text' or 'dot'")
+
+	rootCmd.AddCommand(treeCmd)
+}
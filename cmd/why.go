@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/voidwyrm-2/matrix/api/modpack"
+)
+
+var whyCmd = &cobra.Command{
+	Use:   "why <slug>",
+	Short: "Prints every chain of dependencies that brings a mod into the modpack",
+	Long:  ``,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pack, err := modpack.FromToml(*root_packFile, false, false)
+		if err != nil {
+			return err
+		}
+
+		paths, err := pack.Why(args[0])
+		if err != nil {
+			return err
+		}
+
+		if len(paths) == 0 {
+			fmt.Printf("'%s' is not required by any mod in the Matrixfile\n", args[0])
+			return nil
+		}
+
+		for _, path := range paths {
+			formatted := []string{}
+			for _, m := range path {
+				formatted = append(formatted, m.GetIdOrSlug())
+			}
+
+			fmt.Println(strings.Join(formatted, " -> "))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(whyCmd)
+}
@@ -16,7 +16,7 @@ func _main() error {
 
 func main() {
 	if err := _main(); err != nil {
-		// os.Stderr.WriteString(err.Error() + "\n")
-		os.Exit(1)
+		cmd.PrintError(err)
+		os.Exit(cmd.ExitCode(err))
 	}
 }